@@ -0,0 +1,183 @@
+package fontfind
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Alias is a substitution rule for a font family, modelled after fontconfig's
+// <alias> element. When a font of Family is requested, the families listed in
+// Prefer are tried first, then Family itself, then the families in Accept, and
+// finally the families in Default.
+type Alias struct {
+	Family  string   `json:"family"`
+	Prefer  []string `json:"prefer,omitempty"`
+	Accept  []string `json:"accept,omitempty"`
+	Default []string `json:"default,omitempty"`
+}
+
+// AliasTable is a set of substitution rules, consulted by the resolver
+// pipeline (see package locate) for every font request. Family names are
+// matched case-insensitively, and there is at most one rule per family.
+//
+// An alias table must not be modified while in use.
+type AliasTable struct {
+	rules map[string]Alias
+}
+
+// NewAliasTable creates an alias table from a list of rules. Later rules for a
+// family are merged into earlier ones (see Add).
+func NewAliasTable(aliases ...Alias) *AliasTable {
+	t := &AliasTable{rules: make(map[string]Alias)}
+	for _, a := range aliases {
+		t.Add(a)
+	}
+	return t
+}
+
+func aliasKey(family string) string {
+	return strings.ToLower(strings.TrimSpace(family))
+}
+
+// Add adds a substitution rule. If the table already has a rule for the
+// family, the families of a are added to the existing rule: preferred
+// families are put in front, accepted and default families are appended.
+func (t *AliasTable) Add(a Alias) {
+	if t.rules == nil {
+		t.rules = make(map[string]Alias)
+	}
+	key := aliasKey(a.Family)
+	if key == "" {
+		return
+	}
+	if r, ok := t.rules[key]; ok {
+		a.Family = r.Family
+		a.Prefer = appendFamilies(append([]string(nil), a.Prefer...), r.Prefer...)
+		a.Accept = appendFamilies(append([]string(nil), r.Accept...), a.Accept...)
+		a.Default = appendFamilies(append([]string(nil), r.Default...), a.Default...)
+	}
+	t.rules[key] = a
+}
+
+// appendFamilies appends the families not already contained in list.
+func appendFamilies(list []string, families ...string) []string {
+	for _, f := range families {
+		contained := false
+		for _, g := range list {
+			if aliasKey(f) == aliasKey(g) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// Merge adds all the rules of another table (see Add).
+func (t *AliasTable) Merge(other *AliasTable) {
+	if other == nil {
+		return
+	}
+	for _, a := range other.rules {
+		t.Add(a)
+	}
+}
+
+// Lookup returns the rule for a family, if any.
+func (t *AliasTable) Lookup(family string) (Alias, bool) {
+	if t == nil {
+		return Alias{}, false
+	}
+	a, ok := t.rules[aliasKey(family)]
+	return a, ok
+}
+
+// Len returns the number of rules of a table.
+func (t *AliasTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rules)
+}
+
+// Families returns the families to try for a requested family, in order:
+// preferred families, the family itself, accepted families and default
+// families. Duplicates are removed. Without a rule for family, Families
+// returns family only.
+func (t *AliasTable) Families(family string) []string {
+	a, ok := t.Lookup(family)
+	if !ok {
+		return []string{family}
+	}
+	var families []string
+	seen := make(map[string]bool)
+	add := func(fams ...string) {
+		for _, f := range fams {
+			if k := aliasKey(f); k != "" && !seen[k] {
+				seen[k] = true
+				families = append(families, f)
+			}
+		}
+	}
+	add(a.Prefer...)
+	add(family)
+	add(a.Accept...)
+	add(a.Default...)
+	return families
+}
+
+// LoadAliases reads substitution rules in JSON format, i.e. an array of
+// objects with keys "family", "prefer", "accept" and "default":
+//
+//	[
+//	  { "family": "Helvetica", "prefer": ["Inter"], "accept": ["Liberation Sans"] },
+//	  { "family": "Calibri", "accept": ["Carlito"] }
+//	]
+func LoadAliases(r io.Reader) (*AliasTable, error) {
+	var aliases []Alias
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aliases); err != nil {
+		return nil, err
+	}
+	return NewAliasTable(aliases...), nil
+}
+
+// DefaultAliases returns a new table with the built-in substitution rules,
+// which map common proprietary families to metric-compatible free families
+// (Liberation, Croscore, Carlito/Caladea and TeX Gyre fonts), in the manner
+// of fontconfig's 30-metric-aliases.conf, and generic families (see
+// GenericSerif etc.) to lists of concrete families.
+func DefaultAliases() *AliasTable {
+	t := NewAliasTable(builtinAliases...)
+	for _, a := range builtinGenerics {
+		t.Add(a)
+	}
+	return t
+}
+
+var builtinAliases = []Alias{
+	{Family: "Arial", Accept: []string{"Liberation Sans", "Arimo"}},
+	{Family: "Helvetica", Accept: []string{"TeX Gyre Heros", "Liberation Sans", "Arimo"}},
+	{Family: "Arial Narrow", Accept: []string{"Liberation Sans Narrow"}},
+	{Family: "Times New Roman", Accept: []string{"Liberation Serif", "Tinos"}},
+	{Family: "Times", Accept: []string{"TeX Gyre Termes", "Liberation Serif", "Tinos"}},
+	{Family: "Courier New", Accept: []string{"Liberation Mono", "Cousine"}},
+	{Family: "Courier", Accept: []string{"TeX Gyre Cursor", "Liberation Mono", "Cousine"}},
+	{Family: "Calibri", Accept: []string{"Carlito"}},
+	{Family: "Cambria", Accept: []string{"Caladea"}},
+	{Family: "Palatino", Accept: []string{"TeX Gyre Pagella"}},
+	{Family: "Palatino Linotype", Accept: []string{"TeX Gyre Pagella"}},
+	{Family: "Book Antiqua", Accept: []string{"TeX Gyre Pagella"}},
+	{Family: "Century Schoolbook", Accept: []string{"TeX Gyre Schola"}},
+	{Family: "New Century Schoolbook", Accept: []string{"TeX Gyre Schola"}},
+	{Family: "Bookman", Accept: []string{"TeX Gyre Bonum"}},
+	{Family: "ITC Bookman", Accept: []string{"TeX Gyre Bonum"}},
+	{Family: "Avant Garde", Accept: []string{"TeX Gyre Adventor"}},
+	{Family: "ITC Avant Garde Gothic", Accept: []string{"TeX Gyre Adventor"}},
+	{Family: "Zapf Chancery", Accept: []string{"TeX Gyre Chorus"}},
+}
@@ -0,0 +1,70 @@
+package fontfind
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAliasFamilies(t *testing.T) {
+	table := NewAliasTable(
+		Alias{Family: "Helvetica", Prefer: []string{"Inter"}, Accept: []string{"Liberation Sans"}},
+		Alias{Family: "helvetica", Prefer: []string{"Helvetica Neue"}, Default: []string{"sans-serif", "Inter"}},
+	)
+	families := table.Families("HELVETICA")
+	expected := []string{"Helvetica Neue", "Inter", "HELVETICA", "Liberation Sans", "sans-serif"}
+	if !reflect.DeepEqual(families, expected) {
+		t.Errorf("expected %v, got %v", expected, families)
+	}
+	if families := table.Families("Go"); !reflect.DeepEqual(families, []string{"Go"}) {
+		t.Errorf("expected family without rule to be unchanged, got %v", families)
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	table, err := LoadAliases(strings.NewReader(`[
+		{ "family": "Calibri", "prefer": ["Open Sans"], "accept": ["Carlito"] },
+		{ "family": "Comic Sans MS", "default": ["Comic Neue"] }
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("expected 2 rules, got %d", table.Len())
+	}
+	if a, ok := table.Lookup("calibri"); !ok || a.Prefer[0] != "Open Sans" || a.Accept[0] != "Carlito" {
+		t.Errorf("unexpected rule for Calibri: %+v", a)
+	}
+	if _, err := LoadAliases(strings.NewReader(`[{ "family": "Arial", "replace": ["Arimo"] }]`)); err == nil {
+		t.Errorf("expected unknown rule key to be rejected")
+	}
+	defaults := DefaultAliases()
+	defaults.Merge(table)
+	if a, ok := defaults.Lookup("Calibri"); !ok || !reflect.DeepEqual(a.Accept, []string{"Carlito"}) ||
+		a.Prefer[0] != "Open Sans" {
+		t.Errorf("expected merged rule for Calibri, got %+v", a)
+	}
+	for _, family := range []string{"Arial", "Helvetica", "Times New Roman", "Courier New"} {
+		if len(defaults.Families(family)) < 2 {
+			t.Errorf("expected built-in substitutes for %s", family)
+		}
+	}
+}
+
+func TestGenericFamilies(t *testing.T) {
+	if generic, ok := GenericFamily(" Monospace"); !ok || generic != GenericMonospace {
+		t.Errorf("expected generic family monospace, got %q", generic)
+	}
+	if IsGenericFamily("Noto Serif") {
+		t.Errorf("expected Noto Serif not to be a generic family")
+	}
+	defaults := DefaultAliases()
+	families := defaults.Families("monospace")
+	if len(families) < 2 || families[0] != "Noto Sans Mono" || families[len(families)-1] != "monospace" {
+		t.Errorf("expected concrete families before generic family, got %v", families)
+	}
+	defaults.Add(Alias{Family: GenericMonospace, Prefer: []string{"Iosevka"}})
+	if families := defaults.Families("monospace"); families[0] != "Iosevka" {
+		t.Errorf("expected configured family to be preferred, got %v", families)
+	}
+}
@@ -0,0 +1,130 @@
+package fontfind
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// Font collections (*.ttc, *.otc) bundle several faces into a single file.
+// Faces share tables wherever possible, and each face is addressed by its
+// index in the collection header. See
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff#font-collections
+
+const ttcTag = 0x74746366 // "ttcf"
+
+// IsCollectionPath returns true if a font file name carries the extension of
+// a font collection (*.ttc or *.otc).
+func IsCollectionPath(fontpath string) bool {
+	switch strings.ToLower(path.Ext(fontpath)) {
+	case ".ttc", ".otc":
+		return true
+	}
+	return false
+}
+
+// IsCollection returns true if data starts with a font collection header.
+func IsCollection(data []byte) bool {
+	return len(data) >= 12 && binary.BigEndian.Uint32(data) == ttcTag
+}
+
+// NumFaces returns the number of faces contained in font data. For a single
+// font file (*.ttf, *.otf) the result is 1.
+func NumFaces(data []byte) (int, error) {
+	c, err := sfnt.ParseCollection(data)
+	if err != nil {
+		return 0, err
+	}
+	return c.NumFonts(), nil
+}
+
+// ParseFace parses face number index from font data, which may either be a
+// single font or a font collection. For single fonts, index must be 0.
+func ParseFace(data []byte, index int) (*sfnt.Font, error) {
+	c, err := sfnt.ParseCollection(data)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= c.NumFonts() {
+		return nil, fmt.Errorf("face index %d out of range [0…%d)", index, c.NumFonts())
+	}
+	return c.Font(index)
+}
+
+// MatchCollectionFace searches the faces of a font collection for a face
+// matching a font descriptor.
+// It returns the index of the best matching face, see MatchFontFile.
+func MatchCollectionFace(data []byte, desc Descriptor) (int, bool) {
+	faces, err := ReadFaceInfo(data)
+	if err != nil {
+		tracer().Errorf("cannot enumerate faces of font collection: %v", err)
+		return 0, false
+	}
+	pos, confidence := MatchFaces(faces, desc)
+	if pos >= len(faces) { // collection without faces
+		return 0, false
+	}
+	return faces[pos].Index, confidence > NoConfidence
+}
+
+// extractFace copies face number index out of a font collection and returns
+// it as a stand-alone font file. Tables shared with other faces are
+// duplicated.
+func extractFace(data []byte, index int) ([]byte, error) {
+	if !IsCollection(data) {
+		if index != 0 {
+			return nil, fmt.Errorf("face index %d out of range for single font", index)
+		}
+		return data, nil
+	}
+	be := binary.BigEndian
+	numFonts := int(be.Uint32(data[8:]))
+	if index < 0 || index >= numFonts {
+		return nil, fmt.Errorf("face index %d out of range [0…%d)", index, numFonts)
+	}
+	if len(data) < 12+4*numFonts {
+		return nil, errCorruptCollection
+	}
+	offset := int(be.Uint32(data[12+4*index:]))
+	if offset+12 > len(data) {
+		return nil, errCorruptCollection
+	}
+	numTables := int(be.Uint16(data[offset+4:]))
+	dirLen := 12 + 16*numTables
+	if offset+dirLen > len(data) {
+		return nil, errCorruptCollection
+	}
+	// Layout: offset table + table records, followed by 4-byte aligned tables.
+	// Tables have to lie within data, and the tables of a single face do not
+	// overlap, i.e. cannot take more space than the collection.
+	size := uint64(dirLen)
+	for i := 0; i < numTables; i++ {
+		rec := data[offset+12+16*i:]
+		start, length := uint64(be.Uint32(rec[8:])), uint64(be.Uint32(rec[12:]))
+		if start+length > uint64(len(data)) {
+			return nil, errCorruptCollection
+		}
+		size += (length + 3) &^ 3
+	}
+	if size > uint64(dirLen)+uint64(len(data))+3*uint64(numTables) {
+		return nil, errCorruptCollection
+	}
+	out := make([]byte, dirLen, size)
+	copy(out, data[offset:offset+dirLen])
+	for i := 0; i < numTables; i++ {
+		rec := out[12+16*i:]
+		start, length := be.Uint32(rec[8:]), be.Uint32(rec[12:])
+		be.PutUint32(rec[8:], uint32(len(out)))
+		out = append(out, data[start:start+length]...)
+		for uint32(len(out))%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
+
+var errCorruptCollection = errors.New("corrupt font collection")
@@ -0,0 +1,136 @@
+package fontfind
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestCollectionFaces(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	ttc := makeCollection(t, "Go-Regular.otf", "Go-Bold.otf")
+	if !IsCollection(ttc) {
+		t.Fatalf("expected synthesized data to be a collection")
+	}
+	n, err := NumFaces(ttc)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 faces in collection, got %d (%v)", n, err)
+	}
+	i, ok := MatchCollectionFace(ttc, Descriptor{Pattern: "Go", Style: font.StyleNormal, Weight: font.WeightBold})
+	if !ok || i != 1 {
+		t.Fatalf("expected bold face to be #1, got #%d (%v)", i, ok)
+	}
+	empty := append([]byte{}, ttc[:12]...)
+	binary.BigEndian.PutUint32(empty[8:], 0) // no faces
+	for _, data := range [][]byte{ttc[:12], ttc[:16], ttc[:20], empty} {
+		if _, ok := MatchCollectionFace(data, Descriptor{Pattern: "Go"}); ok {
+			t.Errorf("expected no face to match in truncated collection of %d bytes", len(data))
+		}
+	}
+}
+
+func TestReadFaceData(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	fsys := fstest.MapFS{
+		"Go.ttc": &fstest.MapFile{Data: makeCollection(t, "Go-Regular.otf", "Go-Bold.otf")},
+	}
+	sf := ScalableFont{Name: "Go.ttc"}
+	sf.SetFS(fsys, "Go.ttc")
+	sf.SetCollectionIndex(1)
+	if !sf.IsCollection() {
+		t.Fatalf("expected font to refer to a collection")
+	}
+	data, err := sf.ReadFaceData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsCollection(data) {
+		t.Fatalf("expected extracted face to be a single font")
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatalf("cannot parse extracted face: %v", err)
+	}
+	if sub, _ := f.Name(nil, sfnt.NameIDSubfamily); sub != "Bold" {
+		t.Errorf("expected extracted face to be Bold, is %q", sub)
+	}
+}
+
+func TestExtractFaceOfCorruptCollection(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	be := binary.BigEndian
+	ttc := makeCollection(t, "Go-Regular.otf", "Go-Bold.otf")
+	if _, err := extractFace(ttc[:len(ttc)/2], 1); err == nil {
+		t.Errorf("expected error for truncated collection")
+	}
+	if _, err := extractFace(ttc[:16], 0); err == nil {
+		t.Errorf("expected error for truncated collection header")
+	}
+	offset := int(be.Uint32(ttc[12:]))
+	numTables := int(be.Uint16(ttc[offset+4:]))
+	corrupt := append([]byte{}, ttc...)
+	be.PutUint32(corrupt[offset+12+12:], 0xfffffff0) // length of first table
+	if _, err := extractFace(corrupt, 0); err == nil {
+		t.Errorf("expected error for table exceeding collection")
+	}
+	corrupt = append([]byte{}, ttc...)
+	for i := 0; i < numTables; i++ { // every table spans the complete collection
+		rec := corrupt[offset+12+16*i:]
+		be.PutUint32(rec[8:], 0)
+		be.PutUint32(rec[12:], uint32(len(corrupt)))
+	}
+	if _, err := extractFace(corrupt, 0); err == nil {
+		t.Errorf("expected error for overlapping tables")
+	}
+}
+
+// makeCollection packs packaged fallback fonts into a font collection.
+func makeCollection(t *testing.T, names ...string) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	header := make([]byte, 12+4*len(names))
+	be.PutUint32(header, ttcTag)
+	be.PutUint32(header[4:], 0x00010000)
+	be.PutUint32(header[8:], uint32(len(names)))
+	var dirs, tables [][]byte
+	dirsLen := 0
+	for _, name := range names {
+		data, err := os.ReadFile("locate/fallbackfont/packaged/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		numTables := int(be.Uint16(data[4:]))
+		dir := append([]byte{}, data[:12+16*numTables]...)
+		dirs = append(dirs, dir)
+		tables = append(tables, data)
+		dirsLen += len(dir)
+	}
+	out := header
+	pos := len(header) + dirsLen
+	var body []byte
+	for i, dir := range dirs {
+		be.PutUint32(out[12+4*i:], uint32(len(out)))
+		for j := 0; j < int(be.Uint16(dir[4:])); j++ {
+			rec := dir[12+16*j:]
+			start, length := be.Uint32(rec[8:]), be.Uint32(rec[12:])
+			be.PutUint32(rec[8:], uint32(pos+len(body)))
+			body = append(body, tables[i][start:start+length]...)
+			for len(body)%4 != 0 {
+				body = append(body, 0)
+			}
+		}
+		out = append(out, dir...)
+	}
+	return append(out, body...)
+}
@@ -0,0 +1,271 @@
+package fontfind
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"unicode"
+)
+
+// Coverage is the set of Unicode code points a font has glyphs for, as read
+// from the font's cmap table. See
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cmap
+//
+// Code points mapped to the .notdef glyph are not part of a font's coverage.
+type Coverage struct {
+	ranges []unicode.Range32 // sorted, non-adjacent ranges with stride 1
+}
+
+// HasGlyph returns true if a font has a glyph for rune r.
+func (c *Coverage) HasGlyph(r rune) bool {
+	i := sort.Search(len(c.ranges), func(i int) bool {
+		return c.ranges[i].Hi >= uint32(r)
+	})
+	return i < len(c.ranges) && c.ranges[i].Lo <= uint32(r)
+}
+
+// Covers returns true if a font has glyphs for all the runes of text.
+// White space and control characters are not required to be covered.
+func (c *Coverage) Covers(text string) bool {
+	for _, r := range text {
+		if !c.HasGlyph(r) && !ignorableForCoverage(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// MissingRunes returns the runes of text a font has no glyphs for, in order of
+// their first appearance. White space and control characters are not
+// reported.
+func (c *Coverage) MissingRunes(text string) []rune {
+	var missing []rune
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		if seen[r] || c.HasGlyph(r) || ignorableForCoverage(r) {
+			continue
+		}
+		seen[r] = true
+		missing = append(missing, r)
+	}
+	return missing
+}
+
+func ignorableForCoverage(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// Len returns the number of code points covered.
+func (c *Coverage) Len() int {
+	n := 0
+	for _, rng := range c.ranges {
+		n += int(rng.Hi-rng.Lo) + 1
+	}
+	return n
+}
+
+// RangeTable returns the coverage as a unicode.RangeTable, suitable for use
+// with unicode.Is and friends.
+func (c *Coverage) RangeTable() *unicode.RangeTable {
+	rt := &unicode.RangeTable{}
+	for _, rng := range c.ranges {
+		if rng.Hi <= 0xffff {
+			rt.R16 = append(rt.R16, unicode.Range16{Lo: uint16(rng.Lo), Hi: uint16(rng.Hi), Stride: 1})
+			if rng.Hi <= unicode.MaxLatin1 {
+				rt.LatinOffset++
+			}
+			continue
+		}
+		if rng.Lo <= 0xffff { // split range at the BMP boundary
+			rt.R16 = append(rt.R16, unicode.Range16{Lo: uint16(rng.Lo), Hi: 0xffff, Stride: 1})
+			rng.Lo = 0x10000
+		}
+		rt.R32 = append(rt.R32, rng)
+	}
+	return rt
+}
+
+// Coverage reads the Unicode coverage of the selected face of a scalable
+// font. Coverage is not cached by ScalableFont, see the font registry for
+// caching.
+func (f *ScalableFont) Coverage() (*Coverage, error) {
+	data, err := f.ReadFontData()
+	if err != nil {
+		return nil, err
+	}
+	return ReadCoverage(data, f.index)
+}
+
+// ReadCoverage reads the Unicode coverage of face number index of font data
+// from its cmap table.
+func ReadCoverage(data []byte, index int) (*Coverage, error) {
+	cmap, err := sfntTable(data, index, "cmap")
+	if err != nil {
+		return nil, err
+	}
+	sub, err := unicodeCmap(cmap)
+	if err != nil {
+		return nil, err
+	}
+	var b coverageBuilder
+	if err := b.addSubtable(sub); err != nil {
+		return nil, err
+	}
+	return b.coverage(), nil
+}
+
+var errNoUnicodeCmap = errors.New("font has no supported Unicode cmap subtable")
+
+var errCorruptCmap = errors.New("corrupt cmap table")
+
+// cmapPreference lists the (platform ID, encoding ID) pairs of Unicode cmap
+// subtables in order of preference. Full repertoire subtables come first.
+var cmapPreference = [...][2]uint16{
+	{3, 10}, {0, 6}, {0, 4}, // full Unicode repertoire
+	{3, 1}, {0, 3}, {0, 2}, {0, 1}, {0, 0}, // BMP only
+	{3, 0}, // symbol
+}
+
+// unicodeCmap selects the preferred Unicode subtable of a cmap table.
+func unicodeCmap(cmap []byte) ([]byte, error) {
+	if len(cmap) < 4 {
+		return nil, errCorruptCmap
+	}
+	be := binary.BigEndian
+	numTables := int(be.Uint16(cmap[2:]))
+	if len(cmap) < 4+8*numTables {
+		return nil, errCorruptCmap
+	}
+	best, offset := len(cmapPreference), uint32(0)
+	for i := 0; i < numTables; i++ {
+		rec := cmap[4+8*i:]
+		pid, eid := be.Uint16(rec), be.Uint16(rec[2:])
+		for p, pref := range cmapPreference[:best] {
+			if pref[0] == pid && pref[1] == eid {
+				best, offset = p, be.Uint32(rec[4:])
+				break
+			}
+		}
+	}
+	if best == len(cmapPreference) {
+		return nil, errNoUnicodeCmap
+	}
+	if uint64(offset)+4 > uint64(len(cmap)) {
+		return nil, errCorruptCmap
+	}
+	return cmap[offset:], nil
+}
+
+// coverageBuilder collects code point ranges.
+type coverageBuilder struct {
+	ranges []unicode.Range32
+}
+
+// add adds code points lo…hi.
+func (b *coverageBuilder) add(lo, hi uint32) {
+	if n := len(b.ranges); n > 0 && b.ranges[n-1].Hi+1 == lo {
+		b.ranges[n-1].Hi = hi // extend last range
+		return
+	}
+	b.ranges = append(b.ranges, unicode.Range32{Lo: lo, Hi: hi, Stride: 1})
+}
+
+// coverage sorts and merges the collected ranges.
+func (b *coverageBuilder) coverage() *Coverage {
+	sort.Slice(b.ranges, func(i, j int) bool { return b.ranges[i].Lo < b.ranges[j].Lo })
+	var merged []unicode.Range32
+	for _, rng := range b.ranges {
+		if n := len(merged); n > 0 && merged[n-1].Hi+1 >= rng.Lo {
+			merged[n-1].Hi = max(merged[n-1].Hi, rng.Hi)
+			continue
+		}
+		merged = append(merged, rng)
+	}
+	return &Coverage{ranges: merged}
+}
+
+// addSubtable adds the code points mapped to a glyph other than .notdef by
+// a cmap subtable of format 0, 4, 6, 12 or 13.
+func (b *coverageBuilder) addSubtable(sub []byte) error {
+	be := binary.BigEndian
+	switch format := be.Uint16(sub); format {
+	case 0: // byte encoding table
+		if len(sub) < 6+256 {
+			return errCorruptCmap
+		}
+		for c := uint32(0); c < 256; c++ {
+			if sub[6+c] != 0 {
+				b.add(c, c)
+			}
+		}
+	case 4: // segment mapping to delta values
+		if len(sub) < 14 {
+			return errCorruptCmap
+		}
+		segX2 := int(be.Uint16(sub[6:]))
+		endCodes, startCodes := 14, 16+segX2
+		deltas, rangeOffsets := 16+2*segX2, 16+3*segX2
+		if len(sub) < rangeOffsets+segX2 {
+			return errCorruptCmap
+		}
+		for s := 0; s < segX2; s += 2 {
+			start, end := uint32(be.Uint16(sub[startCodes+s:])), uint32(be.Uint16(sub[endCodes+s:]))
+			delta, rangeOffset := be.Uint16(sub[deltas+s:]), int(be.Uint16(sub[rangeOffsets+s:]))
+			for c := start; c <= end && c != 0xffff; c++ {
+				var glyph uint16
+				if rangeOffset == 0 {
+					glyph = uint16(c) + delta
+				} else {
+					at := rangeOffsets + s + rangeOffset + 2*int(c-start)
+					if at+2 > len(sub) {
+						return errCorruptCmap
+					}
+					if glyph = be.Uint16(sub[at:]); glyph != 0 {
+						glyph += delta
+					}
+				}
+				if glyph != 0 {
+					b.add(c, c)
+				}
+			}
+		}
+	case 6: // trimmed table mapping
+		if len(sub) < 10 {
+			return errCorruptCmap
+		}
+		first, count := uint32(be.Uint16(sub[6:])), int(be.Uint16(sub[8:]))
+		if len(sub) < 10+2*count {
+			return errCorruptCmap
+		}
+		for i := 0; i < count; i++ {
+			if be.Uint16(sub[10+2*i:]) != 0 {
+				b.add(first+uint32(i), first+uint32(i))
+			}
+		}
+	case 12, 13: // segmented coverage, many-to-one range mappings
+		if len(sub) < 16 {
+			return errCorruptCmap
+		}
+		numGroups := int(be.Uint32(sub[12:]))
+		if uint64(len(sub)) < 16+12*uint64(numGroups) {
+			return errCorruptCmap
+		}
+		for i := 0; i < numGroups; i++ {
+			grp := sub[16+12*i:]
+			start, end, glyph := be.Uint32(grp), be.Uint32(grp[4:]), be.Uint32(grp[8:])
+			if start > end || end > unicode.MaxRune {
+				return errCorruptCmap
+			}
+			if glyph == 0 { // first (format 12) or all (format 13) code points map to .notdef
+				if format == 13 || start == end {
+					continue
+				}
+				start++
+			}
+			b.add(start, end)
+		}
+	default:
+		return errNoUnicodeCmap
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package fontfind
+
+import (
+	"os"
+	"testing"
+	"unicode"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestCoverage(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	sf := FallbackFont()
+	c, err := sf.Coverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasGlyph('A') || !c.HasGlyph('ß') || !c.HasGlyph('Ω') {
+		t.Errorf("expected Go Regular to cover Latin and Greek letters")
+	}
+	if c.HasGlyph('अ') || c.HasGlyph('😀') {
+		t.Errorf("expected Go Regular not to cover Devanagari and emoji")
+	}
+	missing := c.MissingRunes("Grüße, नमस्ते 😀 नमस्ते!")
+	if len(missing) != 7 || missing[0] != 'न' || missing[6] != '😀' {
+		t.Errorf("unexpected missing runes %q", string(missing))
+	}
+	if !c.Covers("Hello, World!\n") {
+		t.Errorf("expected Go Regular to cover ASCII text")
+	}
+	rt := c.RangeTable()
+	if !unicode.Is(rt, 'q') || unicode.Is(rt, 'अ') {
+		t.Errorf("range table does not reflect coverage")
+	}
+}
+
+// TestCoverageAgainstGlyphIndex checks coverage against glyph lookup by
+// package sfnt.
+func TestCoverageAgainstGlyphIndex(t *testing.T) {
+	data, err := os.ReadFile("locate/fallbackfont/packaged/GentiumPlus-R.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadCoverage(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	for r := rune(0); r < 0x3000; r++ {
+		g, err := f.GlyphIndex(&buf, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (g != 0) != c.HasGlyph(r) {
+			t.Fatalf("coverage of %U differs from glyph index %d", r, g)
+		}
+	}
+}
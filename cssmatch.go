@@ -0,0 +1,213 @@
+package fontfind
+
+import (
+	"math"
+
+	"golang.org/x/image/font"
+)
+
+// Font matching follows the algorithm of CSS Fonts Level 4, section 5.2
+// (https://www.w3.org/TR/css-fonts-4/#font-style-matching): from the faces of
+// a family, first the faces with the closest width are selected, then the
+// faces with the closest style, and finally the faces with the closest
+// weight. The algorithm always selects a face, and the match confidence
+// tells how close it is to the request.
+
+// FaceProperties describes a face of a font family as seen by the font
+// matching algorithm. Weight and stretch are ranges, to cover variable fonts.
+// For static fonts, minimum and maximum are equal.
+type FaceProperties struct {
+	Style      font.Style
+	WeightMin  float32 // numeric weight (CSS font-weight, 1…1000)
+	WeightMax  float32
+	StretchMin Stretch
+	StretchMax Stretch
+}
+
+// StaticFace returns the properties of a static face with a given style,
+// weight and stretch.
+func StaticFace(style font.Style, weight float32, stretch Stretch) FaceProperties {
+	stretch = stretch.Normalized()
+	return FaceProperties{
+		Style:      style,
+		WeightMin:  weight,
+		WeightMax:  weight,
+		StretchMin: stretch,
+		StretchMax: stretch,
+	}
+}
+
+// VariantProperties returns the properties of a font variant given by name,
+// as used by the Google Fonts directory (e.g., "regular", "600italic").
+func VariantProperties(variantName string, stretch Stretch) FaceProperties {
+	style, weight := variantStyleAndWeightValue(variantName)
+	return StaticFace(style, weight, stretch)
+}
+
+func (fp FaceProperties) weightFor(desired float32) float32 {
+	return min(max(desired, fp.WeightMin), fp.WeightMax)
+}
+
+func (fp FaceProperties) stretchFor(desired Stretch) Stretch {
+	return min(max(desired, fp.StretchMin.Normalized()), fp.StretchMax.Normalized())
+}
+
+// FindClosestFace selects the face closest to a font descriptor, following
+// the CSS font matching algorithm. desc.Pattern is not considered, i.e.
+// faces are assumed to be of the requested family.
+//
+// FindClosestFace returns the index of the selected face together with the
+// match confidence. If faces is empty, the index is -1.
+func FindClosestFace(faces []FaceProperties, desc Descriptor) (int, MatchConfidence) {
+	indices, confidence := closestFaces(faces, desc)
+	if len(indices) == 0 {
+		return -1, NoConfidence
+	}
+	return indices[0], confidence
+}
+
+// closestFaces returns the indices of all the faces which are equally close
+// to desc, in order.
+func closestFaces(faces []FaceProperties, desc Descriptor) ([]int, MatchConfidence) {
+	if len(faces) == 0 {
+		return nil, NoConfidence
+	}
+	set := make([]int, len(faces))
+	for i := range faces {
+		set[i] = i
+	}
+	// 1. font-stretch
+	desiredStretch := desc.Stretch.Normalized()
+	stretches := make([]Stretch, len(set))
+	for i, j := range set {
+		stretches[i] = faces[j].stretchFor(desiredStretch)
+	}
+	stretch := ClosestStretch(stretches, desiredStretch)
+	set = filterFaces(set, func(j int) bool { return faces[j].stretchFor(desiredStretch) == stretch })
+	// 2. font-style
+	style := closestStyle(faces, set, desc.Style)
+	set = filterFaces(set, func(j int) bool { return faces[j].Style == style })
+	// 3. font-weight
+	desiredWeight := desc.WeightValue()
+	weights := make([]float32, len(set))
+	for i, j := range set {
+		weights[i] = faces[j].weightFor(desiredWeight)
+	}
+	weight := closestWeight(weights, desiredWeight)
+	set = filterFaces(set, func(j int) bool { return faces[j].weightFor(desiredWeight) == weight })
+	//
+	confidence := min(StyleConfidence(style, desc.Style), WeightConfidence(weight, desiredWeight))
+	if stretch != desiredStretch && confidence > HighConfidence {
+		confidence = HighConfidence
+	}
+	return set, confidence
+}
+
+func filterFaces(set []int, keep func(int) bool) []int {
+	filtered := set[:0]
+	for _, j := range set {
+		if keep(j) {
+			filtered = append(filtered, j)
+		}
+	}
+	return filtered
+}
+
+// styleFallbacks lists for each requested style the order in which available
+// styles are considered.
+var styleFallbacks = map[font.Style][]font.Style{
+	font.StyleNormal:  {font.StyleNormal, font.StyleOblique, font.StyleItalic},
+	font.StyleItalic:  {font.StyleItalic, font.StyleOblique, font.StyleNormal},
+	font.StyleOblique: {font.StyleOblique, font.StyleItalic, font.StyleNormal},
+}
+
+func closestStyle(faces []FaceProperties, set []int, desired font.Style) font.Style {
+	for _, style := range styleFallbacks[desired] {
+		for _, j := range set {
+			if faces[j].Style == style {
+				return style
+			}
+		}
+	}
+	return desired
+}
+
+// closestWeight selects from a set of available weights the one to use for a
+// requested weight, following the CSS font matching rules:
+//
+//   - If the requested weight is between 400 and 500, weights up to 500 are
+//     checked in ascending order, then weights below the requested one in
+//     descending order, then weights above 500 in ascending order.
+//   - If the requested weight is less than 400, weights below it are checked
+//     in descending order, then weights above it in ascending order.
+//   - If the requested weight is greater than 500, weights above it are
+//     checked in ascending order, then weights below it in descending order.
+func closestWeight(available []float32, desired float32) float32 {
+	// closest weight within (lo…hi], if ascending, or [lo…hi), if descending
+	closest := func(lo, hi float32, ascending bool) (float32, bool) {
+		found, best := false, float32(0)
+		for _, w := range available {
+			if ascending && w > lo && w <= hi && (!found || w < best) {
+				found, best = true, w
+			} else if !ascending && w >= lo && w < hi && (!found || w > best) {
+				found, best = true, w
+			}
+		}
+		return best, found
+	}
+	for _, w := range available {
+		if w == desired {
+			return w
+		}
+	}
+	type span struct {
+		lo, hi    float32
+		ascending bool
+	}
+	var order []span
+	switch {
+	case desired >= 400 && desired <= 500:
+		order = []span{{desired, 500, true}, {0, desired, false}, {500, math.MaxFloat32, true}}
+	case desired < 400:
+		order = []span{{0, desired, false}, {desired, math.MaxFloat32, true}}
+	default:
+		order = []span{{desired, math.MaxFloat32, true}, {0, desired, false}}
+	}
+	for _, s := range order {
+		if w, ok := closest(s.lo, s.hi, s.ascending); ok {
+			return w
+		}
+	}
+	return desired
+}
+
+// StyleConfidence rates an available style for a requested one. Italic and
+// oblique are considered close to each other. A normal face may be used for a
+// slanted request with low confidence (clients may synthesize slanting), but
+// a slanted face is no match for a request for normal style.
+func StyleConfidence(available, requested font.Style) MatchConfidence {
+	switch {
+	case available == requested:
+		return PerfectConfidence
+	case requested == font.StyleNormal:
+		return NoConfidence
+	case available == font.StyleNormal:
+		return LowConfidence
+	}
+	return HighConfidence // italic for oblique and vice versa
+}
+
+// WeightConfidence rates an available numeric weight for a requested one:
+// perfect for equal weights, high for a difference of up to 100, low for a
+// difference of up to 300.
+func WeightConfidence(available, requested float32) MatchConfidence {
+	switch d := math.Abs(float64(available - requested)); {
+	case d < 1:
+		return PerfectConfidence
+	case d <= 100:
+		return HighConfidence
+	case d <= 300:
+		return LowConfidence
+	}
+	return NoConfidence
+}
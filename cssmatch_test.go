@@ -0,0 +1,74 @@
+package fontfind
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+)
+
+func TestClosestWeight(t *testing.T) {
+	for _, c := range []struct {
+		available []float32
+		desired   float32
+		expected  float32
+	}{
+		{[]float32{300, 400, 700}, 400, 400},
+		{[]float32{300, 500, 700}, 400, 500}, // up to 500 first
+		{[]float32{300, 600, 700}, 450, 300}, // then lighter
+		{[]float32{600, 700}, 450, 600},      // then heavier
+		{[]float32{100, 300, 500}, 200, 100}, // lighter first
+		{[]float32{300, 500, 900}, 600, 900}, // heavier first
+		{[]float32{300, 500}, 800, 500},      // then lighter
+	} {
+		if w := closestWeight(c.available, c.desired); w != c.expected {
+			t.Errorf("expected weight %v for %v out of %v, got %v", c.expected, c.desired, c.available, w)
+		}
+	}
+}
+
+func TestFindClosestFace(t *testing.T) {
+	faces := []FaceProperties{
+		StaticFace(font.StyleNormal, 400, StretchNormal),
+		StaticFace(font.StyleNormal, 600, StretchNormal),
+		StaticFace(font.StyleOblique, 400, StretchNormal),
+		StaticFace(font.StyleNormal, 400, StretchCondensed),
+	}
+	for _, c := range []struct {
+		desc       Descriptor
+		index      int
+		confidence MatchConfidence
+	}{
+		{Descriptor{Weight: font.WeightSemiBold}, 1, PerfectConfidence},
+		{Descriptor{Weight: font.WeightBold}, 1, HighConfidence},
+		{Descriptor{Style: font.StyleItalic}, 2, HighConfidence},
+		{Descriptor{Stretch: StretchSemiCondensed}, 3, HighConfidence},
+		{Descriptor{Variations: map[string]float32{AxisWeight: 650}}, 1, HighConfidence},
+	} {
+		i, confidence := FindClosestFace(faces, c.desc)
+		if i != c.index || confidence != c.confidence {
+			t.Errorf("expected face #%d (confidence %d) for %+v, got #%d (confidence %d)",
+				c.index, c.confidence, c.desc, i, confidence)
+		}
+	}
+	variable := []FaceProperties{{Style: font.StyleNormal, WeightMin: 100, WeightMax: 900,
+		StretchMin: StretchCondensed, StretchMax: StretchNormal}}
+	desc := Descriptor{Stretch: StretchSemiCondensed, Variations: map[string]float32{AxisWeight: 650}}
+	if _, confidence := FindClosestFace(variable, desc); confidence != PerfectConfidence {
+		t.Errorf("expected variable face to match perfectly, confidence is %d", confidence)
+	}
+}
+
+func TestClosestMatch(t *testing.T) {
+	fdescs := []FontVariantsLocation{{
+		Family:   "Noto Sans",
+		Variants: []string{"regular", "italic", "600", "700", "700italic"},
+	}}
+	_, v, confidence := ClosestMatch(fdescs, "noto", font.StyleNormal, font.WeightSemiBold)
+	if v != "600" || confidence != PerfectConfidence {
+		t.Errorf("expected perfect match of 600 for semibold, got %q (confidence %d)", v, confidence)
+	}
+	_, v, _ = ClosestMatch(fdescs, "noto", font.StyleItalic, font.WeightSemiBold)
+	if v != "700italic" {
+		t.Errorf("expected 700italic for semibold italic, got %q", v)
+	}
+}
@@ -0,0 +1,147 @@
+package fontfind
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors for font resolution. Errors returned by the locators and the
+// resolver pipeline (package locate) match these with errors.Is.
+var (
+	// ErrNotFound signals that no font matches a request.
+	ErrNotFound = errors.New("font not found")
+	// ErrFallbackSubstituted signals that a fallback font has been delivered
+	// instead of the requested one.
+	ErrFallbackSubstituted = errors.New("fallback font substituted")
+	// ErrSourceUnavailable signals that a font source could not be queried,
+	// e.g., because of network problems or missing configuration.
+	ErrSourceUnavailable = errors.New("font source unavailable")
+	// ErrInvalidPattern signals a malformed font request, e.g. a syntax error
+	// in a fontconfig pattern.
+	ErrInvalidPattern = errors.New("invalid font pattern")
+	// ErrCancelled signals that a font search has been cancelled or its
+	// deadline has been exceeded. Errors matching ErrCancelled match the
+	// respective context error as well.
+	ErrCancelled = errors.New("font search cancelled")
+)
+
+// NotFoundError reports that a source does not contain a font matching a
+// request. It matches ErrNotFound.
+type NotFoundError struct {
+	Name   string // font name or pattern searched for
+	Source string // where the font has been searched, e.g. "registry" or "system"
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("font %s not found", e.Name)
+	}
+	return fmt.Sprintf("font %s not found in %s", e.Name, e.Source)
+}
+
+// Is reports whether target is ErrNotFound.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// SourceError reports that a font source could not be queried. It matches
+// ErrSourceUnavailable and wraps the underlying error.
+type SourceError struct {
+	Source string // font source, e.g. "google"
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("font source %s unavailable: %v", e.Source, e.Err)
+}
+
+// Is reports whether target is ErrSourceUnavailable.
+func (e *SourceError) Is(target error) bool {
+	return target == ErrSourceUnavailable
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// PatternError reports a malformed font pattern. It matches ErrInvalidPattern
+// and wraps the underlying error, if any.
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("invalid font pattern %q", e.Pattern)
+	}
+	return fmt.Sprintf("invalid font pattern %q: %v", e.Pattern, e.Err)
+}
+
+// Is reports whether target is ErrInvalidPattern.
+func (e *PatternError) Is(target error) bool {
+	return target == ErrInvalidPattern
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// ResolverError is the failure of a single resolver of a resolver chain.
+type ResolverError struct {
+	Resolver string // resolver name
+	Err      error
+}
+
+func (e *ResolverError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Resolver, e.Err)
+}
+
+func (e *ResolverError) Unwrap() error {
+	return e.Err
+}
+
+// ResolutionError reports that a font request could not be resolved. It
+// joins the failures of the individual resolvers (as *ResolverError), which
+// may be inspected with errors.As or by ranging over Failures. A resolution
+// error matches ErrNotFound and, if a fallback font has been delivered in
+// place of the requested font, ErrFallbackSubstituted.
+type ResolutionError struct {
+	Key      string  // normalized registry key of the request
+	Failures []error // failures of the resolvers attempted, in order
+	Fallback bool    // a fallback font has been substituted
+}
+
+func (e *ResolutionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "font not found: %s", e.Key)
+	if e.Fallback {
+		b.WriteString(" (fallback font substituted)")
+	}
+	for _, err := range e.Failures {
+		b.WriteString("; ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrNotFound, or ErrFallbackSubstituted for
+// substituted fonts.
+func (e *ResolutionError) Is(target error) bool {
+	return target == ErrNotFound || (e.Fallback && target == ErrFallbackSubstituted)
+}
+
+// Unwrap returns the failures of the resolvers.
+func (e *ResolutionError) Unwrap() []error {
+	return e.Failures
+}
+
+// Cancelled wraps an error of a context (see context.Context.Err) to match
+// ErrCancelled. The returned error matches the context error as well.
+func Cancelled(ctxErr error) error {
+	if ctxErr == nil || errors.Is(ctxErr, ErrCancelled) {
+		return ctxErr
+	}
+	return fmt.Errorf("%w: %w", ErrCancelled, ctxErr)
+}
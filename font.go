@@ -5,7 +5,7 @@ There is a certain confusion with the nomenclature of typesetting. We will
 stick to the following definitions:
 
 ▪︎ A "typeface" is a family of fonts. An example is "Helvetica".
-This corresponds to a TrueType "collection" (*.ttc).
+This often corresponds to a TrueType "collection" (*.ttc).
 
 ▪︎ A "scalable font" is a font, i.e. a variant of a typeface with a
 certain weight, slant, etc.  An example is "Helvetica regular".
@@ -13,15 +13,28 @@ certain weight, slant, etc.  An example is "Helvetica regular".
 ▪︎ A "typecase" is a scaled font, i.e. a font in a certain size for
 a certain script and language. The name is reminiscend on the wooden
 boxes of typesetters in the era of metal type.
-An example is "Helvetica regular 11pt, Latin, en_US".
+An example is "Helvetica regular 11pt, Latin, en_US". Typecases are
+represented by type Typecase.
 
 Please note that Go (Golang) does use the terms "font" and "face"
 differently–actually more or less in an opposite manner.
 
-# Status
+# Font Collections
 
-Does not yet contain methods for font collections (*.ttc), e.g.,
-/System/Library/Fonts/Helvetica.ttc on Mac OS.
+Font collections (*.ttc, *.otc), e.g., /System/Library/Fonts/Helvetica.ttc
+on Mac OS, contain more than one face. A ScalableFont resolved from a
+collection carries the index of the selected face within the collection.
+ReadFontData will return the data of the complete collection, while
+ReadFaceData will return the selected face only.
+
+# Variable Fonts
+
+Variable fonts span a continuous design space along variation axes, e.g.
+weight or width. A variable font file matches every request within the
+ranges of its axes. A ScalableFont resolved to a variable font carries the
+axes and named instances of the font, together with the axis coordinates
+realizing the request (see ScalableFont.Coordinates). Applying these
+coordinates when rasterizing is up to clients.
 
 # Links
 
@@ -43,6 +56,7 @@ import (
 	"embed"
 	"errors"
 	"io/fs"
+	"path/filepath"
 
 	"github.com/npillmayer/schuko/tracing"
 	"golang.org/x/image/font"
@@ -68,19 +82,95 @@ const (
 )
 
 // Descriptor describes a requested scalable font by family pattern, style, and weight.
+//
+// Optionally, a descriptor may request a font width (Stretch), an optical
+// size, and arbitrary values for OpenType variation axes
+// (https://docs.microsoft.com/en-us/typography/opentype/spec/dvaraxisreg),
+// keyed by axis tag, e.g. "wght" or "GRAD". Zero values mean "don't care".
+//
+// Size is the font size a font is requested for. It is carried along for
+// clients, but not used for font matching.
+//
+// Families optionally holds a font stack, i.e. an ordered list of families as
+// in CSS font-family, of which the first one available is to be used. The
+// resolver pipeline (package locate) tries every family with all resolvers
+// before moving on to the next one. Pattern should be the first family of the
+// stack; locators, which search for a single family, use Pattern only.
+//
+// Descriptors may be parsed from fontconfig patterns (see ParseFontconfig) or
+// from the CSS font shorthand (see ParseCSSFont).
 type Descriptor struct {
-	Pattern string
-	Style   font.Style
-	Weight  font.Weight
+	Pattern     string
+	Families    []string // font stack, tried in order; overrides Pattern for the pipeline
+	Style       font.Style
+	Weight      font.Weight
+	Stretch     Stretch            // font width, zero for normal width
+	OpticalSize float32            // optical size in points, zero for any
+	Variations  map[string]float32 // variation axis values by axis tag
+	Size        float32            // font size in points, zero if unspecified
+}
+
+// FontStack returns a descriptor for a font stack of families, tried in order
+// (see Descriptor.Families), of regular style and weight.
+func FontStack(families ...string) Descriptor {
+	d := Descriptor{Families: append([]string(nil), families...)}
+	if len(families) > 0 {
+		d.Pattern = families[0]
+	}
+	return d
 }
 
+// FamilyStack returns the families requested by a descriptor, in order:
+// Families, if set, or Pattern otherwise.
+func (d Descriptor) FamilyStack() []string {
+	if len(d.Families) > 0 {
+		return d.Families
+	}
+	return []string{d.Pattern}
+}
+
+// WeightValue returns the numeric weight (CSS font-weight, 1…1000) requested
+// by a descriptor. An explicit value for the "wght" variation axis takes
+// precedence over Weight, allowing for weights in between the font.Weight
+// constants, e.g. 650.
+func (d Descriptor) WeightValue() float32 {
+	if w, ok := d.Variations[AxisWeight]; ok && w > 0 {
+		return w
+	}
+	return float32(WeightClass(d.Weight))
+}
+
+// FontSource identifies the kind of font source a scalable font has been
+// resolved from.
+type FontSource string
+
+const (
+	SourceUnknown  FontSource = ""
+	SourceEmbedded FontSource = "embedded" // packaged fonts embedded into the binary
+	SourceSystem   FontSource = "system"   // locally installed fonts
+	SourceGoogle   FontSource = "google"   // Google Fonts, cached locally
+	SourceTestdata FontSource = "testdata" // fonts from a test data directory
+)
+
 // ScalableFont describes a concrete font variant and where to load it from.
+//
+// Family, Style, Weight and Stretch describe the font as it has been found,
+// which may differ from what has been requested. Confidence tells how well the font
+// matches the request it has been resolved for, and Source tells where it
+// has been found.
 type ScalableFont struct {
-	Name       string
-	Style      font.Style
-	Weight     font.Weight
+	Name       string          // name of the font file
+	Family     string          // family name of the font
+	Style      font.Style      // actual style of the font
+	Weight     font.Weight     // actual weight of the font
+	Stretch    Stretch         // actual width of the font, zero if unknown
+	Confidence MatchConfidence // how well the font matches the request
+	Source     FontSource      // kind of source the font was resolved from
 	fileSystem fs.FS
 	path       string
+	hostPath   string     // location of the font file in the host file system, if any
+	index      int        // face index within a font collection
+	variation  *Variation // design space of a variable font, nil for static fonts
 }
 
 // SetFS sets file-system and path for loading font bytes.
@@ -94,7 +184,43 @@ func (f *ScalableFont) Path() string {
 	return f.path
 }
 
+// SetHostPath records the location of the font file in the host file system,
+// for fonts loaded from local files (installed or cached fonts). It does not
+// change the file system used for loading font bytes (see SetFS). Registries
+// use the host path to persist fonts and to detect changed font files.
+func (f *ScalableFont) SetHostPath(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	f.hostPath = path
+}
+
+// HostPath returns the location of the font file in the host file system, or
+// an empty string for fonts not loaded from a local file, e.g. embedded fonts.
+func (f *ScalableFont) HostPath() string {
+	return f.hostPath
+}
+
+// SetCollectionIndex selects a face within a font collection.
+func (f *ScalableFont) SetCollectionIndex(index int) {
+	f.index = index
+}
+
+// CollectionIndex returns the index of the face within a font collection.
+// For fonts not loaded from a collection, CollectionIndex returns 0.
+func (f *ScalableFont) CollectionIndex() int {
+	return f.index
+}
+
+// IsCollection returns true if this font refers to a face within a font
+// collection (*.ttc, *.otc).
+func (f *ScalableFont) IsCollection() bool {
+	return IsCollectionPath(f.path)
+}
+
 // ReadFontData reads the raw bytes of this scalable font from its configured file-system.
+// For font collections, this is the data of the complete collection.
+// Use ReadFaceData to extract the selected face.
 func (f *ScalableFont) ReadFontData() ([]byte, error) {
 	if f.fileSystem == nil {
 		return nil, errors.New("no file system to read from")
@@ -105,21 +231,59 @@ func (f *ScalableFont) ReadFontData() ([]byte, error) {
 	return fs.ReadFile(f.fileSystem, f.path)
 }
 
+// ReadFaceData reads the raw bytes of the selected face of this scalable font.
+// For font collections, the face is extracted into a stand-alone font file.
+// For single fonts, ReadFaceData is equivalent to ReadFontData.
+func (f *ScalableFont) ReadFaceData() ([]byte, error) {
+	data, err := f.ReadFontData()
+	if err != nil {
+		return nil, err
+	}
+	return extractFace(data, f.index)
+}
+
 // NullFont is the zero-value marker used when no scalable font could be resolved.
 var NullFont = ScalableFont{}
 
-//go:embed locate/fallbackfont/packaged/Go-Regular.otf
+//go:embed locate/fallbackfont/packaged/Go-Regular.otf locate/fallbackfont/packaged/Go-Bold.otf
+//go:embed locate/fallbackfont/packaged/Go-Italic.otf locate/fallbackfont/packaged/Go-Bold-Italic.otf
 var fallbackFS embed.FS
 
 // FallbackFont returns the default packaged fallback font.
 func FallbackFont() ScalableFont {
-	return ScalableFont{
-		Name:       "Go-Regular.otf",
-		Style:      font.StyleNormal,
-		Weight:     font.WeightNormal,
-		path:       "locate/fallbackfont/packaged/Go-Regular.otf",
-		fileSystem: fallbackFS,
+	return FallbackFontFor(Descriptor{})
+}
+
+// FallbackFontFor returns the packaged fallback font closest to the style and
+// weight of a descriptor: Go regular, bold, italic or bold italic. Weights of
+// semi-bold and above are considered bold.
+func FallbackFontFor(desc Descriptor) ScalableFont {
+	f := ScalableFont{
+		Family: "Go",
+		Style:  font.StyleNormal,
+		Weight: font.WeightNormal,
+		Source: SourceEmbedded,
+	}
+	variant := "Regular"
+	bold := desc.WeightValue() >= 600
+	italic := desc.Style == font.StyleItalic || desc.Style == font.StyleOblique
+	switch {
+	case bold && italic:
+		variant = "Bold-Italic"
+	case bold:
+		variant = "Bold"
+	case italic:
+		variant = "Italic"
+	}
+	if bold {
+		f.Weight = font.WeightBold
+	}
+	if italic {
+		f.Style = font.StyleItalic
 	}
+	f.Name = "Go-" + variant + ".otf"
+	f.SetFS(fallbackFS, "locate/fallbackfont/packaged/"+f.Name)
+	return f
 }
 
 // ---------------------------------------------------------------------------
@@ -150,9 +314,11 @@ _d/_em = gtx.Px(DPI) * (PT / 72.27)
 var PtIn fixed.Int26_6 = fixed.I(72) + fixed.I(27)/100
 
 // PpEm calculates a ppem value for a given font point-size and an output resolution (dpi).
+// Intermediate results are calculated in 64 bits, i.e. without truncating
+// ptSize/PtIn to an integer.
 func PpEm(ptSize fixed.Int26_6, dpi float32) fixed.Int26_6 {
 	_dpi := fixed.Int26_6(dpi * 64)
-	return _dpi * (ptSize / PtIn)
+	return fixed.Int26_6(int64(_dpi) * int64(ptSize) / int64(PtIn))
 }
 
 // RasterCoords transforms `u`, a value in font-units, into pixel coordinates.
@@ -161,6 +327,6 @@ func RasterCoords(u sfnt.Units, sfont *sfnt.Font, ptSize fixed.Int26_6, dpi floa
 	_ppem := PpEm(ptSize, dpi)
 	uem := sfont.UnitsPerEm()
 	_uem := fixed.I(int(uem))
-	_u := fixed.I(int(u)) * _ppem / _uem
-	return _u
+	_u := int64(fixed.I(int(u))) * int64(_ppem) / int64(_uem)
+	return fixed.Int26_6(_u)
 }
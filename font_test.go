@@ -0,0 +1,46 @@
+package fontfind
+
+import (
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestPpEm(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		ptSize fixed.Int26_6
+		dpi    float32
+		ppem   fixed.Int26_6
+	}{
+		{fixed.I(12), 72.27, fixed.I(12)},
+		{fixed.I(12), 144.54, fixed.I(24)},
+		{fixed.I(10), 72.27, fixed.I(10)},
+		{fixed.I(100), 72.27, fixed.I(100)},
+		{fixed.I(12), 72, 765}, // 11.95 pixels
+	} {
+		if ppem := PpEm(c.ptSize, c.dpi); ppem != c.ppem {
+			t.Errorf("expected %v ppem for %v pt at %v dpi, got %v", c.ppem, c.ptSize, c.dpi, ppem)
+		}
+	}
+	f := FallbackFont()
+	data, err := f.ReadFontData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upem := sf.UnitsPerEm()
+	if x := RasterCoords(upem, sf, fixed.I(12), 144.54); x != fixed.I(24) {
+		t.Errorf("expected 1 em at 12pt and 144.54 dpi to be 24 pixels, got %v", x)
+	}
+	if x := RasterCoords(upem/4, sf, fixed.I(12), 72.27); x != fixed.I(3) {
+		t.Errorf("expected 1/4 em at 12pt to be 3 pixels, got %v", x)
+	}
+}
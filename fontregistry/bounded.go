@@ -0,0 +1,181 @@
+package fontregistry
+
+import (
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
+)
+
+// Limits bound the capacity of a registry. Zero values mean "unlimited".
+//
+// MaxBytes bounds the font data cached with the registry's fonts (see
+// FontData). Pinned fonts count against the limits, but are never evicted.
+type Limits struct {
+	MaxEntries int   // maximum number of fonts
+	MaxBytes   int64 // maximum number of bytes of cached font data
+}
+
+// NewBounded creates an empty font registry with limits. Whenever the
+// registry exceeds its limits, the least recently used fonts which are not
+// pinned are evicted.
+func NewBounded(limits Limits) *Registry {
+	fr := New()
+	fr.limits = limits
+	return fr
+}
+
+// SetLimits changes the limits of a registry, evicting fonts as necessary.
+// Passing zero limits makes the registry unbounded.
+func (fr *Registry) SetLimits(limits Limits) {
+	fr.Lock()
+	fr.limits = limits
+	evicted := fr.evict()
+	obs, onEvict := fr.observer, fr.onEvict
+	fr.Unlock()
+	notifyEvicted(evicted, obs, onEvict)
+}
+
+// SetEvictionCallback sets a function to be called for every font evicted
+// from the registry, with the normalized name and the font evicted. The
+// callback is not called with the registry locked. Passing nil removes the
+// callback.
+func (fr *Registry) SetEvictionCallback(callback func(normalizedName string, f fontfind.ScalableFont)) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.onEvict = callback
+}
+
+// Pin protects a font from eviction. Pin returns false if the registry does
+// not contain a font for normalizedName.
+func (fr *Registry) Pin(normalizedName string) bool {
+	fr.Lock()
+	defer fr.Unlock()
+	e, ok := fr.fonts[normalizedName]
+	if ok {
+		e.pinned = true
+	}
+	return ok
+}
+
+// Unpin makes a pinned font evictable again. The font will be evicted as soon
+// as the registry exceeds its limits and the font is the least recently used.
+func (fr *Registry) Unpin(normalizedName string) {
+	fr.Lock()
+	if e, ok := fr.fonts[normalizedName]; ok {
+		e.pinned = false
+	}
+	evicted := fr.evict()
+	obs, onEvict := fr.observer, fr.onEvict
+	fr.Unlock()
+	notifyEvicted(evicted, obs, onEvict)
+}
+
+// Len returns the number of fonts in the registry.
+func (fr *Registry) Len() int {
+	fr.Lock()
+	defer fr.Unlock()
+	return len(fr.fonts)
+}
+
+// Size returns the number of bytes of font data cached in the registry.
+func (fr *Registry) Size() int64 {
+	fr.Lock()
+	defer fr.Unlock()
+	return fr.size
+}
+
+// FontData returns the binary data of a cached font by normalized name. The
+// data is read on first request and cached along with the font, counting
+// against the registry's MaxBytes limit.
+//
+// If the registry does not contain a font for normalizedName, FontData
+// returns an error.
+func (fr *Registry) FontData(normalizedName string) ([]byte, error) {
+	fr.Lock()
+	e, ok := fr.fonts[normalizedName]
+	if ok {
+		fr.lru.MoveToFront(e.elem)
+	}
+	if ok && e.data != nil {
+		fr.Unlock()
+		return e.data, nil
+	}
+	fr.Unlock()
+	if !ok {
+		return nil, &fontfind.NotFoundError{Name: normalizedName, Source: "registry"}
+	}
+	f := e.font
+	data, err := f.ReadFontData()
+	if err != nil {
+		return nil, err
+	}
+	fr.Lock()
+	// Another goroutine may have read the data meanwhile, or the font may have
+	// been evicted or replaced.
+	if cur, ok := fr.fonts[normalizedName]; ok && cur == e {
+		if e.data != nil {
+			data = e.data
+		} else {
+			e.data = data
+			fr.size += int64(len(data))
+		}
+	}
+	evicted := fr.evict()
+	obs, onEvict := fr.observer, fr.onEvict
+	fr.Unlock()
+	notifyEvicted(evicted, obs, onEvict)
+	return data, nil
+}
+
+// --- LRU housekeeping ------------------------------------------------------
+
+// add inserts a font as the most recently used one. The registry has to be
+// locked.
+func (fr *Registry) add(normalizedName string, f fontfind.ScalableFont) *entry {
+	e := &entry{key: normalizedName, font: f}
+	e.elem = fr.lru.PushFront(e)
+	fr.fonts[normalizedName] = e
+	return e
+}
+
+// remove deletes an entry, together with its coverage. The registry has to be
+// locked.
+func (fr *Registry) remove(e *entry) {
+	fr.lru.Remove(e.elem)
+	delete(fr.fonts, e.key)
+	delete(fr.coverage, e.key)
+	fr.size -= int64(len(e.data))
+}
+
+func (fr *Registry) exceedsLimits() bool {
+	return (fr.limits.MaxEntries > 0 && len(fr.fonts) > fr.limits.MaxEntries) ||
+		(fr.limits.MaxBytes > 0 && fr.size > fr.limits.MaxBytes)
+}
+
+// evict removes least recently used fonts which are not pinned until the
+// registry is within its limits, and returns the entries removed. The
+// registry has to be locked.
+func (fr *Registry) evict() []*entry {
+	var evicted []*entry
+	for elem := fr.lru.Back(); elem != nil && fr.exceedsLimits(); {
+		e := elem.Value.(*entry)
+		elem = elem.Prev()
+		if e.pinned {
+			continue
+		}
+		tracer().Debugf("registry evicts font %s", e.key)
+		fr.remove(e)
+		evicted = append(evicted, e)
+	}
+	return evicted
+}
+
+// notifyEvicted reports evicted fonts to an observer and an eviction
+// callback, either of which may be nil.
+func notifyEvicted(evicted []*entry, obs observe.Observer, onEvict func(string, fontfind.ScalableFont)) {
+	for _, e := range evicted {
+		observe.Emit(obs, observe.Event{Kind: observe.RegistryEvict, Key: e.key, Bytes: int64(len(e.data))})
+		if onEvict != nil {
+			onEvict(e.key, e.font)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package fontregistry
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
+)
+
+// Entry is a font of a registry, as listed by Snapshot.
+type Entry struct {
+	Key      string                // normalized name
+	Font     fontfind.ScalableFont // font stored under Key
+	Pinned   bool                  // font is protected from eviction (see Pin)
+	DataSize int64                 // bytes of font data cached (see FontData)
+}
+
+// Keys returns the normalized names of all the fonts in the registry, sorted.
+func (fr *Registry) Keys() []string {
+	fr.Lock()
+	keys := make([]string, 0, len(fr.fonts))
+	for k := range fr.fonts {
+		keys = append(keys, k)
+	}
+	fr.Unlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// Snapshot returns all the fonts in the registry, sorted by key. The entries
+// are taken consistently, i.e. with the registry locked once.
+func (fr *Registry) Snapshot() []Entry {
+	fr.Lock()
+	entries := make([]Entry, 0, len(fr.fonts))
+	for k, e := range fr.fonts {
+		entries = append(entries, Entry{Key: k, Font: e.font, Pinned: e.pinned, DataSize: int64(len(e.data))})
+	}
+	fr.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Lookup returns the font stored under a normalized name, if any. Other than
+// GetFont, Lookup does not fall back to the fallback font, does not count as
+// a use of the font for eviction and does not report events.
+func (fr *Registry) Lookup(normalizedName string) (fontfind.ScalableFont, bool) {
+	fr.Lock()
+	defer fr.Unlock()
+	if e, ok := fr.fonts[normalizedName]; ok {
+		return e.font, true
+	}
+	return fontfind.NullFont, false
+}
+
+// Replace stores a font under a normalized name, replacing the font stored
+// before, if any. Other than StoreFont, Replace allows correcting a bad
+// entry. Cached coverage and font data of the former font are dropped; a pin
+// is kept.
+func (fr *Registry) Replace(normalizedName string, f fontfind.ScalableFont) {
+	if f.Name == "" {
+		tracer().Errorf("registry cannot store null font")
+		return
+	}
+	id := fr.identify(f)
+	fr.Lock()
+	pinned := false
+	if e, ok := fr.fonts[normalizedName]; ok {
+		pinned = e.pinned
+		fr.remove(e)
+	}
+	tracer().Debugf("registry replaces font %s by %s", normalizedName, f.Name)
+	e := fr.add(normalizedName, f)
+	e.id, e.pinned = id, pinned
+	delete(fr.misses, normalizedName)
+	evicted := fr.evict()
+	obs, onEvict := fr.observer, fr.onEvict
+	fr.Unlock()
+	observe.Emit(obs, observe.Event{Kind: observe.RegistryStore, Key: normalizedName})
+	notifyEvicted(evicted, obs, onEvict)
+}
+
+// Remove removes the font stored under a normalized name, even if it is
+// pinned, and returns true if there has been one. Removing fonts is not
+// reported to the eviction callback.
+func (fr *Registry) Remove(normalizedName string) bool {
+	fr.Lock()
+	defer fr.Unlock()
+	e, ok := fr.fonts[normalizedName]
+	if ok {
+		fr.remove(e)
+	}
+	return ok
+}
+
+// RemovePrefix removes all the fonts with a normalized name starting with
+// prefix, where prefix has to span the complete family part of the name (see
+// NormalizeDescriptor), and returns the number of fonts removed. For example,
+// "noto_sans" removes all the fonts of family Noto Sans, but neither those of
+// Noto Sans Mono nor those of a family Noto-Sans-Display.
+func (fr *Registry) RemovePrefix(prefix string) int {
+	fr.Lock()
+	defer fr.Unlock()
+	n := 0
+	for k, e := range fr.fonts {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if ok && (rest == "" || strings.HasPrefix(rest, "-")) && len(keyFamily(k)) <= len(prefix) {
+			fr.remove(e)
+			n++
+		}
+	}
+	return n
+}
+
+// Clear removes all the fonts and the cached fallback fonts, which will be
+// loaded again on demand, and forgets all failed lookups.
+func (fr *Registry) Clear() {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.fonts = make(map[string]*entry)
+	fr.lru.Init()
+	fr.coverage = make(map[string]*fontfind.Coverage)
+	fr.misses = make(map[string]miss)
+	fr.fallbacks = make(map[fallbackKey]fontfind.ScalableFont)
+	fr.fallbackGen++
+	fr.size = 0
+}
@@ -0,0 +1,107 @@
+package fontregistry
+
+import (
+	"github.com/npillmayer/fontfind"
+	xfont "golang.org/x/image/font"
+)
+
+// Fallback configures the fallback fonts of a registry, i.e. the fonts
+// delivered in place of fonts which cannot be found.
+//
+// Families is a font stack of fallback families, tried in order with Locator,
+// which is called with descriptors of the requested style, weight and width.
+// Any locator of package locate may be used, e.g. fallbackfont.Find().
+// If Families is empty, Locator is nil or no family can be located, the
+// packaged Go font closest to the requested style and weight is used (see
+// fontfind.FallbackFontFor).
+type Fallback struct {
+	Families []string                                                 // fallback font stack
+	Locator  func(fontfind.Descriptor) (fontfind.ScalableFont, error) // locates fallback families
+}
+
+// fallbackKey identifies a cached fallback font by the requested style,
+// weight and width.
+type fallbackKey struct {
+	style   xfont.Style
+	weight  float32
+	stretch fontfind.Stretch // zero for normal width
+}
+
+func newFallbackKey(desc fontfind.Descriptor) fallbackKey {
+	key := fallbackKey{style: desc.Style, weight: desc.WeightValue(), stretch: desc.Stretch}
+	if key.stretch.IsNormal() {
+		key.stretch = 0
+	}
+	return key
+}
+
+// SetFallback configures the fallback fonts of a registry. Fallback fonts
+// cached before are dropped.
+func (fr *Registry) SetFallback(fb Fallback) {
+	fb.Families = append([]string(nil), fb.Families...)
+	fr.Lock()
+	defer fr.Unlock()
+	fr.fallback = fb
+	fr.fallbacks = make(map[fallbackKey]fontfind.ScalableFont)
+	fr.fallbackGen++
+}
+
+// FallbackFont returns the fallback font of regular style and weight (see
+// FallbackFontFor).
+func (fr *Registry) FallbackFont() (fontfind.ScalableFont, error) {
+	return fr.FallbackFontFor(fontfind.Descriptor{})
+}
+
+// FallbackFontFor returns the fallback font for the style, weight and width
+// requested by desc; the families requested are ignored. Fallback fonts are
+// located on first request (see Fallback) and cached apart from the fonts
+// stored by name: they are never evicted, neither listed nor saved with the
+// registry's fonts, and cannot collide with a font of any name.
+func (fr *Registry) FallbackFontFor(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+	key := newFallbackKey(desc)
+	for {
+		fr.Lock()
+		if f, ok := fr.fallbacks[key]; ok {
+			fr.Unlock()
+			return f, nil
+		}
+		fb, gen := fr.fallback, fr.fallbackGen
+		fr.Unlock()
+
+		f := fb.locate(desc)
+		fr.Lock()
+		// Another goroutine may have cached a fallback font while we were loading.
+		if cached, ok := fr.fallbacks[key]; ok {
+			fr.Unlock()
+			return cached, nil
+		}
+		if fr.fallbackGen == gen {
+			tracer().Infof("font registry caches fallback font %s", f.Name)
+			fr.fallbacks[key] = f
+			fr.Unlock()
+			return f, nil
+		}
+		fr.Unlock() // fallback has been reconfigured while we were loading
+	}
+}
+
+// locate returns the first family of the fallback font stack which can be
+// located for the style, weight and width of desc, or the packaged fallback
+// font.
+func (fb Fallback) locate(desc fontfind.Descriptor) fontfind.ScalableFont {
+	if fb.Locator != nil {
+		for _, family := range fb.Families {
+			d := fontfind.Descriptor{Pattern: family, Style: desc.Style, Weight: desc.Weight,
+				Stretch: desc.Stretch}
+			if w, ok := desc.Variations[fontfind.AxisWeight]; ok {
+				d.Variations = map[string]float32{fontfind.AxisWeight: w}
+			}
+			f, err := fb.Locator(d)
+			if err == nil && f.Name != "" {
+				return f
+			}
+			tracer().Infof("cannot locate fallback family %s: %v", family, err)
+		}
+	}
+	return fontfind.FallbackFontFor(desc)
+}
@@ -1,9 +1,17 @@
 package fontregistry
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/schuko/tracing"
 	"github.com/npillmayer/schuko/tracing/gotestingadapter"
 	"golang.org/x/image/font"
 )
@@ -21,6 +29,8 @@ func TestGuess(t *testing.T) {
 		"fonts/Clarendon-bold.ttf":               {font.StyleNormal, font.WeightBold},
 		"Microsoft/Gill Sans MT Bold Italic.ttf": {font.StyleItalic, font.WeightBold},
 		"Cambria Math.ttf":                       {font.StyleNormal, font.WeightNormal},
+		"NotoSans-SemiCondensedMediumItalic.ttf": {font.StyleItalic, font.WeightMedium},
+		"Roboto-ThinItalic.ttf":                  {font.StyleItalic, font.WeightThin},
 	} {
 		style, weight := fontfind.GuessStyleAndWeight(k)
 		t.Logf("style = %d, weight = %d", style, weight)
@@ -56,6 +66,41 @@ func TestNormalizeFont(t *testing.T) {
 	if n != "clarendon-italic-bold" {
 		t.Errorf("expected different normalized name for clarendon")
 	}
+	n = NormalizeDescriptor(fontfind.Descriptor{
+		Pattern:     "Roboto",
+		Weight:      font.WeightBold,
+		Stretch:     fontfind.StretchSemiCondensed,
+		OpticalSize: 12,
+		Variations:  map[string]float32{"wght": 650, "GRAD": -25},
+	})
+	if n != "roboto-bold-semicondensed-opsz12-GRAD-25-wght650" {
+		t.Errorf("expected different normalized name for roboto, got %s", n)
+	}
+	keys := make(map[string]font.Weight)
+	for w := font.WeightThin; w <= font.WeightBlack; w++ {
+		k := NormalizeFontname("Go", font.StyleNormal, w)
+		if other, ok := keys[k]; ok {
+			t.Errorf("expected distinct keys for weights %v and %v, both are %s", other, w, k)
+		}
+		keys[k] = w
+	}
+	if n = NormalizeFontname("Go", font.StyleNormal, font.WeightBlack); n != "go-w900" {
+		t.Errorf("expected numeric weight in normalized name for black, got %s", n)
+	}
+}
+
+func TestKeyFamily(t *testing.T) {
+	for _, desc := range []fontfind.Descriptor{
+		{Pattern: "Foo-Bar"},
+		{Pattern: "Foo-Bar", Style: font.StyleItalic, Weight: font.WeightSemiBold},
+		{Pattern: "Foo-Bar", Weight: font.WeightBold, Stretch: fontfind.StretchUltraExpanded},
+		{Pattern: "Foo-Bar", Stretch: 110, OpticalSize: 9.5, Variations: map[string]float32{"GRAD": -25, "wght": 650}},
+	} {
+		key := NormalizeDescriptor(desc)
+		if f := keyFamily(key); f != "foo-bar" {
+			t.Errorf("expected family foo-bar for key %s, got %s", key, f)
+		}
+	}
 }
 
 func TestRegistryFallbackFont(t *testing.T) {
@@ -72,6 +117,84 @@ func TestRegistryFallbackFont(t *testing.T) {
 	}
 }
 
+func TestRegistryStyledFallback(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	f, _ := fr.FallbackFontFor(fontfind.Descriptor{Pattern: "nosuch", Style: font.StyleItalic, Weight: font.WeightBold})
+	if f.Name != "Go-Bold-Italic.otf" || f.Style != font.StyleItalic || f.Weight != font.WeightBold {
+		t.Errorf("expected fallback font Go-Bold-Italic.otf, got %s", f.Name)
+	}
+	fr.StoreFont("fallback", fontfind.FallbackFontFor(fontfind.Descriptor{Weight: font.WeightBold}))
+	if f, _ := fr.FallbackFont(); f.Name != "Go-Regular.otf" {
+		t.Errorf("expected font named fallback not to collide with fallback font, got %s", f.Name)
+	}
+	if fr.Len() != 1 {
+		t.Errorf("expected fallback fonts to be kept apart from fonts, got %v", fr.Keys())
+	}
+	//
+	var located []fontfind.Descriptor
+	fr.SetFallback(Fallback{
+		Families: []string{"nosuch", "Go Mono"},
+		Locator: func(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+			located = append(located, desc)
+			if desc.Pattern != "Go Mono" {
+				return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern}
+			}
+			return fontfind.ScalableFont{Name: "Go-Mono-Bold.otf", Family: desc.Pattern, Weight: desc.Weight}, nil
+		},
+	})
+	desc := fontfind.Descriptor{Pattern: "nosuch", Weight: font.WeightBold}
+	if f, _ := fr.FallbackFontFor(desc); f.Name != "Go-Mono-Bold.otf" {
+		t.Errorf("expected configured fallback family Go Mono, got %s", f.Name)
+	}
+	if len(located) != 2 || located[1].Weight != font.WeightBold {
+		t.Errorf("expected fallback families to be located in order by weight, got %v", located)
+	}
+	fr.FallbackFontFor(desc)
+	desc.Stretch = fontfind.StretchNormal
+	fr.FallbackFontFor(desc)
+	if len(located) != 2 {
+		t.Errorf("expected fallback font to be cached, for any notation of normal width")
+	}
+	fr.SetFallback(Fallback{Families: []string{"nosuch"}, Locator: func(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern}
+	}})
+	if f, _ := fr.FallbackFontFor(desc); f.Name != "Go-Bold.otf" {
+		t.Errorf("expected packaged fallback font Go-Bold.otf, got %s", f.Name)
+	}
+}
+
+func TestRegistryFallbackReconfiguredWhileLoading(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	started, release := make(chan struct{}), make(chan struct{})
+	fr.SetFallback(Fallback{Families: []string{"Old"}, Locator: func(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		close(started)
+		<-release
+		return fontfind.ScalableFont{Name: "old.ttf"}, nil
+	}})
+	result := make(chan fontfind.ScalableFont)
+	go func() {
+		f, _ := fr.FallbackFont()
+		result <- f
+	}()
+	<-started
+	fr.SetFallback(Fallback{Families: []string{"New"}, Locator: func(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.ScalableFont{Name: "new.ttf"}, nil
+	}})
+	close(release)
+	if f := <-result; f.Name != "new.ttf" {
+		t.Errorf("expected fallback font of new configuration, got %s", f.Name)
+	}
+	if f, _ := fr.FallbackFont(); f.Name != "new.ttf" {
+		t.Errorf("expected outdated fallback font not to be cached, got %s", f.Name)
+	}
+}
+
 func TestRegistryFontReturnsFallbackOnMiss(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "resources")
 	defer teardown()
@@ -85,3 +208,326 @@ func TestRegistryFontReturnsFallbackOnMiss(t *testing.T) {
 		t.Fatalf("expected fallback font Go-Regular.otf, got %s", f.Name)
 	}
 }
+
+func TestRegistryCoverage(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	fr.StoreFont("go", fontfind.FallbackFont())
+	c, err := fr.Coverage("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasGlyph('a') || !c.HasGlyph('é') || c.HasGlyph('अ') {
+		t.Errorf("unexpected coverage of Go Regular")
+	}
+	if c2, _ := fr.Coverage("go"); c2 != c {
+		t.Errorf("expected coverage to be cached")
+	}
+	if _, err := fr.Coverage("font-not-in-registry"); err == nil {
+		t.Errorf("expected error for coverage of unknown font")
+	}
+}
+
+func TestRegistryMisses(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	reason := errors.New("no such font")
+	fr.StoreMiss("nosuch", reason, time.Hour)
+	if err := fr.Miss("nosuch"); err != reason {
+		t.Errorf("expected stored miss reason, got %v", err)
+	}
+	fr.InvalidateMiss("nosuch")
+	if err := fr.Miss("nosuch"); err != nil {
+		t.Errorf("expected invalidated miss to be gone, got %v", err)
+	}
+	fr.StoreMiss("go", reason, time.Hour)
+	fr.StoreFont("go", fontfind.FallbackFont())
+	if err := fr.Miss("go"); err != nil {
+		t.Errorf("expected storing a font to invalidate its miss, got %v", err)
+	}
+	fr.StoreMiss("short", reason, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := fr.Miss("short"); err != nil {
+		t.Errorf("expected miss to expire, got %v", err)
+	}
+}
+
+func TestBoundedRegistryEvictsLeastRecentlyUsed(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := NewBounded(Limits{MaxEntries: 3})
+	var evicted []string
+	fr.SetEvictionCallback(func(name string, _ fontfind.ScalableFont) {
+		evicted = append(evicted, name)
+	})
+	f := fontfind.FallbackFont()
+	fr.StoreFont("p", f)
+	fr.Pin("p")
+	fr.StoreFont("a", f)
+	fr.StoreFont("b", f)
+	fr.GetFont("a") // b is least recently used now
+	fr.StoreFont("c", f)
+	if fr.Len() != 3 || !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("expected b to be evicted, evicted %v, %d fonts left", evicted, fr.Len())
+	}
+	if _, err := fr.GetFont("p"); err != nil {
+		t.Errorf("expected pinned font to survive eviction")
+	}
+	//
+	fr.SetLimits(Limits{MaxBytes: 1})
+	if _, err := fr.FontData("c"); err != nil {
+		t.Fatal(err)
+	}
+	if fr.Size() != 0 || fr.Len() != 1 {
+		t.Errorf("expected fonts to be evicted for byte limit, got %d fonts of %d bytes", fr.Len(), fr.Size())
+	}
+	fr.SetLimits(Limits{})
+	fr.StoreFont("d", f)
+	data, err := fr.FontData("d")
+	if err != nil || fr.Size() != int64(len(data)) {
+		t.Errorf("expected font data to be accounted, got %d bytes of %d (%v)", fr.Size(), len(data), err)
+	}
+}
+
+func TestRegistryIndex(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fallback := fontfind.FallbackFont()
+	data, err := fallback.ReadFontData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fontpath := filepath.Join(dir, "Go-Regular.otf")
+	if err := os.WriteFile(fontpath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := fontfind.ScalableFont{Name: "Go-Regular.otf", Family: "Go", Source: fontfind.SourceSystem,
+		Confidence: fontfind.PerfectConfidence}
+	f.SetFS(os.DirFS(dir), "Go-Regular.otf")
+	f.SetHostPath(fontpath)
+	fr := New()
+	fr.StoreFont("go", f)
+	fr.StoreFont("embedded", fallback) // not saved
+	indexpath := filepath.Join(dir, "index.json")
+	if err := fr.SaveIndexFile(indexpath); err != nil {
+		t.Fatal(err)
+	}
+	//
+	warm := New()
+	if n, err := warm.LoadIndexFile(indexpath); err != nil || n != 1 {
+		t.Fatalf("expected 1 font loaded from index, got %d (%v)", n, err)
+	}
+	g, err := warm.GetFont("go")
+	if err != nil || g.HostPath() != fontpath || g.Family != "Go" || g.Confidence != fontfind.PerfectConfidence {
+		t.Fatalf("expected font from index, got %+v (%v)", g, err)
+	}
+	if b, err := g.ReadFontData(); err != nil || len(b) != len(data) {
+		t.Errorf("expected font data to be readable from index entry, got %d bytes (%v)", len(b), err)
+	}
+	// touched, but unchanged file is still current
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fontpath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := New().LoadIndexFile(indexpath); n != 1 {
+		t.Errorf("expected touched font file to be recognized by its hash")
+	}
+	// changed file is stale
+	if err := os.WriteFile(fontpath, append(data, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := New().LoadIndexFile(indexpath); err != nil || n != 0 {
+		t.Errorf("expected stale entry to be dropped, got %d fonts (%v)", n, err)
+	}
+	if _, err := New().LoadIndex(strings.NewReader(`{"version": 99, "fonts": []}`)); err == nil {
+		t.Errorf("expected index of unknown version to be rejected")
+	}
+}
+
+func TestRegistryEntries(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	f := fontfind.FallbackFont()
+	for _, k := range []string{"noto_sans", "noto_sans-bold", "go"} {
+		fr.StoreFont(k, f)
+	}
+	fr.Pin("go")
+	if keys := fr.Keys(); !reflect.DeepEqual(keys, []string{"go", "noto_sans", "noto_sans-bold"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if snap := fr.Snapshot(); len(snap) != 3 || snap[0].Key != "go" || !snap[0].Pinned {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+	if _, ok := fr.Lookup("nosuch"); ok || fr.Len() != 3 {
+		t.Errorf("expected lookup of unknown font to fail without storing the fallback font")
+	}
+	better := f
+	better.Name = "Go-Better.otf"
+	fr.StoreFont("go", better)
+	if g, _ := fr.Lookup("go"); g.Name != f.Name {
+		t.Errorf("expected StoreFont not to override a font")
+	}
+	fr.Replace("go", better)
+	if g, _ := fr.Lookup("go"); g.Name != better.Name || !fr.Snapshot()[0].Pinned {
+		t.Errorf("expected Replace to override a font and to keep its pin, got %q", g.Name)
+	}
+	fr.StoreFont("noto_sans_mono", f)
+	if n := fr.RemovePrefix("noto_sans"); n != 2 || fr.Len() != 2 {
+		t.Errorf("expected 2 fonts removed by prefix, got %d, %d left", n, fr.Len())
+	}
+	if _, ok := fr.Lookup("noto_sans_mono"); !ok {
+		t.Errorf("expected prefix to match at family boundaries only")
+	}
+	fr.StoreFont("foo-bar-bold", f)
+	fr.StoreFont("foo-italic-w600-condensed", f)
+	if n := fr.RemovePrefix("foo"); n != 1 {
+		t.Errorf("expected 1 font of family foo removed, got %d", n)
+	}
+	if _, ok := fr.Lookup("foo-bar-bold"); !ok || fr.RemovePrefix("foo-bar") != 1 {
+		t.Errorf("expected prefix to match complete family names containing a hyphen")
+	}
+	if !fr.Remove("go") || fr.Remove("go") {
+		t.Errorf("expected font to be removed once")
+	}
+	fr.StoreFont("go", f)
+	fr.StoreMiss("nosuch", errors.New("no such font"), time.Hour)
+	fr.Clear()
+	if fr.Len() != 0 || fr.Miss("nosuch") != nil {
+		t.Errorf("expected cleared registry to be empty")
+	}
+}
+
+func TestRegistryConcurrentLogFontList(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fr := New()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			fr.StoreFont(fmt.Sprintf("font-%d", i), fontfind.FallbackFont())
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		fr.LogFontList(tracing.Select("resources"))
+	}
+	<-done
+}
+
+func TestRegistryRevalidation(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fallback := fontfind.FallbackFont()
+	data, err := fallback.ReadFontData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	localFont := func(name string) fontfind.ScalableFont {
+		fontpath := filepath.Join(dir, name)
+		if err := os.WriteFile(fontpath, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f := fontfind.ScalableFont{Name: name, Family: "Go", Source: fontfind.SourceSystem}
+		f.SetFS(os.DirFS(dir), name)
+		f.SetHostPath(fontpath)
+		return f
+	}
+	fr := New()
+	fr.StoreFont("go", localFont("Go.otf"))
+	os.WriteFile(filepath.Join(dir, "Go.otf"), append(data, 0), 0o644)
+	if _, err := fr.GetFont("go"); err != nil {
+		t.Errorf("expected changed font file to go unnoticed without revalidation, got %v", err)
+	}
+	fr.SetRevalidation(Revalidation{Policy: RevalidateOnAccess, Hash: true})
+	if _, err := fr.GetFont("go"); !errors.Is(err, fontfind.ErrNotFound) {
+		t.Errorf("expected font with changed font file to be dropped on access, got %v", err)
+	}
+	if _, ok := fr.Lookup("go"); ok {
+		t.Errorf("expected dropped font to be removed from the registry")
+	}
+	// touched, but unchanged file is still valid with a hash
+	fr.StoreFont("go", localFont("Go.otf"))
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "Go.otf"), later, later)
+	if _, err := fr.GetFont("go"); err != nil {
+		t.Errorf("expected touched font file to be recognized by its hash, got %v", err)
+	}
+	//
+	fr.SetRevalidation(Revalidation{Policy: RevalidatePeriodically, Interval: time.Millisecond})
+	defer fr.Close()
+	fr.StoreFont("go-bold", localFont("Go-Bold.otf"))
+	os.Remove(filepath.Join(dir, "Go-Bold.otf"))
+	deadline := time.Now().Add(time.Second)
+	for _, ok := fr.Lookup("go-bold"); ok && time.Now().Before(deadline); _, ok = fr.Lookup("go-bold") {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := fr.Lookup("go-bold"); ok {
+		t.Errorf("expected font with removed font file to be dropped by polling")
+	}
+	fr.Close()
+	fr.StoreFont("go-italic", localFont("Go-Italic.otf"))
+	os.Remove(filepath.Join(dir, "Go-Italic.otf"))
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := fr.Lookup("go-italic"); !ok {
+		t.Errorf("expected closed registry to stop polling")
+	}
+}
+
+func TestRegistryIndexReusesFileIdentity(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	fallback := fontfind.FallbackFont()
+	data, err := fallback.ReadFontData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fontpath := filepath.Join(dir, "Go-Regular.otf")
+	if err := os.WriteFile(fontpath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := fontfind.ScalableFont{Name: "Go-Regular.otf", Family: "Go", Source: fontfind.SourceSystem}
+	f.SetFS(os.DirFS(dir), "Go-Regular.otf")
+	f.SetHostPath(fontpath)
+	fr := New()
+	fr.StoreFont("go", f)
+	var first, second strings.Builder
+	if err := fr.SaveIndex(&first); err != nil {
+		t.Fatal(err)
+	}
+	if fr.fonts["go"].id.hash == "" {
+		t.Fatalf("expected hash to be recorded when saving the index")
+	}
+	// contents changed behind the registry's back, but neither size nor time
+	info, _ := os.Stat(fontpath)
+	changed := append([]byte{}, data...)
+	changed[len(changed)-1] ^= 0xff
+	os.WriteFile(fontpath, changed, 0o644)
+	os.Chtimes(fontpath, info.ModTime(), info.ModTime())
+	if err := fr.SaveIndex(&second); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("expected unchanged font file not to be hashed again")
+	}
+	warm := New()
+	if n, err := warm.LoadIndex(strings.NewReader(first.String())); err != nil || n != 1 {
+		t.Fatalf("expected 1 font loaded from index, got %d (%v)", n, err)
+	}
+	if id := warm.fonts["go"].id; id == nil || id.hash != fr.fonts["go"].id.hash {
+		t.Errorf("expected identity of font file to be taken from the index")
+	}
+}
@@ -0,0 +1,224 @@
+package fontregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/npillmayer/fontfind"
+	xfont "golang.org/x/image/font"
+)
+
+// IndexVersion is the version of the index format written by SaveIndex.
+// LoadIndex rejects indexes of other versions.
+const IndexVersion = 1
+
+// Index is the persistent form of a registry's fonts, see SaveIndex. It is
+// encoded as JSON.
+type Index struct {
+	Version int          `json:"version"`
+	Fonts   []IndexEntry `json:"fonts"`
+}
+
+// IndexEntry is a font of an index, stored under a normalized name (Key).
+// Fonts are identified by the absolute path of their font file, and the
+// file's size, modification time and SHA-256 content hash.
+type IndexEntry struct {
+	Key        string                   `json:"key"`
+	Name       string                   `json:"name"`
+	Family     string                   `json:"family,omitempty"`
+	Style      xfont.Style              `json:"style"`
+	Weight     xfont.Weight             `json:"weight"`
+	Stretch    fontfind.Stretch         `json:"stretch,omitempty"`
+	Confidence fontfind.MatchConfidence `json:"confidence"`
+	Source     fontfind.FontSource      `json:"source"`
+	Path       string                   `json:"path"`
+	Index      int                      `json:"index,omitempty"` // face index within a font collection
+	Variation  *fontfind.Variation      `json:"variation,omitempty"`
+	Size       int64                    `json:"size"`
+	ModTime    time.Time                `json:"mtime"`
+	Hash       string                   `json:"sha256"`
+}
+
+// SaveIndex writes the registry's fonts as a JSON index, which LoadIndex
+// reads back, e.g. on the next start of an application.
+//
+// Only fonts loaded from files in the host file system (see
+// fontfind.ScalableFont.HostPath) are saved. Embedded fonts are cheap to
+// resolve again. Fonts whose files cannot be read or have changed since the
+// fonts have been stored are skipped.
+func (fr *Registry) SaveIndex(w io.Writer) error {
+	fr.Lock()
+	keys := make([]string, 0, len(fr.fonts))
+	entries := make(map[string]*entry, len(fr.fonts))
+	for k, e := range fr.fonts {
+		if e.font.HostPath() != "" {
+			keys = append(keys, k)
+			entries[k] = e
+		}
+	}
+	fr.Unlock()
+	sort.Strings(keys)
+	index := Index{Version: IndexVersion, Fonts: make([]IndexEntry, 0, len(keys))}
+	for _, k := range keys {
+		f := entries[k].font
+		id, err := fr.indexIdentity(entries[k])
+		if err != nil {
+			tracer().Infof("registry index skips font %s: %v", k, err)
+			continue
+		}
+		entry := IndexEntry{
+			Key:        k,
+			Name:       f.Name,
+			Family:     f.Family,
+			Style:      f.Style,
+			Weight:     f.Weight,
+			Stretch:    f.Stretch,
+			Confidence: f.Confidence,
+			Source:     f.Source,
+			Path:       f.HostPath(),
+			Index:      f.CollectionIndex(),
+			Size:       id.size,
+			ModTime:    id.modTime,
+			Hash:       id.hash,
+		}
+		if f.IsVariable() {
+			v := f.Variation()
+			entry.Variation = &v
+		}
+		index.Fonts = append(index.Fonts, entry)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(index)
+}
+
+// LoadIndex reads a JSON index written by SaveIndex and stores its fonts in
+// the registry, without overriding fonts already present (see StoreFont). It
+// returns the number of fonts stored.
+//
+// Entries whose font file has been removed or changed since the index has been
+// saved are dropped. A file is considered unchanged if it has the recorded
+// size and modification time, or, if only the modification time differs, the
+// recorded content hash.
+func (fr *Registry) LoadIndex(r io.Reader) (int, error) {
+	var index Index
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return 0, fmt.Errorf("cannot decode registry index: %w", err)
+	}
+	if index.Version != IndexVersion {
+		return 0, fmt.Errorf("registry index has version %d, expected %d", index.Version, IndexVersion)
+	}
+	n := 0
+	for _, entry := range index.Fonts {
+		if entry.Key == "" || !filepath.IsAbs(entry.Path) {
+			continue
+		}
+		if !entry.isCurrent() {
+			tracer().Infof("registry index entry %s is stale, dropped", entry.Key)
+			continue
+		}
+		id := entry.identity()
+		if fr.storeIdentified(entry.Key, entry.font(), &id) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// isCurrent checks the identity of an entry's font file.
+func (entry IndexEntry) isCurrent() bool {
+	return entry.identity().current(entry.Path)
+}
+
+// identity returns the identity of an entry's font file, as recorded in the
+// index.
+func (entry IndexEntry) identity() fileIdentity {
+	return fileIdentity{size: entry.Size, modTime: entry.ModTime, hash: entry.Hash}
+}
+
+// indexIdentity returns the identity of an entry's font file to be saved in
+// the index. The identity recorded at store time is reused, as long as the
+// file has not changed. Files are hashed only if no hash has been recorded
+// before, and the hash is recorded for subsequent saves.
+func (fr *Registry) indexIdentity(e *entry) (fileIdentity, error) {
+	fr.Lock()
+	id := e.id
+	fr.Unlock()
+	path := e.font.HostPath()
+	if id == nil {
+		return statFile(path, true)
+	}
+	if !id.current(path) {
+		return fileIdentity{}, errors.New("font file has changed")
+	}
+	if id.hash != "" {
+		return *id, nil
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	hashed := *id
+	hashed.hash = hash
+	fr.Lock()
+	if e.id == id {
+		e.id = &hashed
+	}
+	fr.Unlock()
+	return hashed, nil
+}
+
+// font recreates the font of an entry.
+func (entry IndexEntry) font() fontfind.ScalableFont {
+	f := fontfind.ScalableFont{
+		Name:       entry.Name,
+		Family:     entry.Family,
+		Style:      entry.Style,
+		Weight:     entry.Weight,
+		Stretch:    entry.Stretch,
+		Confidence: entry.Confidence,
+		Source:     entry.Source,
+	}
+	dir, file := filepath.Split(entry.Path)
+	f.SetFS(os.DirFS(dir), file)
+	f.SetHostPath(entry.Path)
+	f.SetCollectionIndex(entry.Index)
+	if entry.Variation != nil {
+		f.SetVariation(*entry.Variation)
+	}
+	return f
+}
+
+// SaveIndexFile writes the registry's index to a file (see SaveIndex). The
+// file is replaced atomically.
+func (fr *Registry) SaveIndexFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+	if err := fr.SaveIndex(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadIndexFile reads the registry's index from a file (see LoadIndex).
+func (fr *Registry) LoadIndexFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return fr.LoadIndex(f)
+}
@@ -1,19 +1,68 @@
 package fontregistry
 
 import (
+	"container/list"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
 	"github.com/npillmayer/schuko/tracing"
 	xfont "golang.org/x/image/font"
 )
 
 // Registry caches resolved scalable fonts by normalized name.
+//
+// Additionally, a registry caches the Unicode coverage of its fonts, which is
+// computed on first request (see Coverage).
+//
+// A registry also remembers failed lookups (misses) for a limited time, see
+// StoreMiss.
+//
+// Fonts not found may be replaced by fallback fonts, which are kept apart from
+// the fonts stored by name (see SetFallback).
+//
+// Registries created by New are unbounded. A bounded registry (see NewBounded)
+// evicts the least recently used fonts when it exceeds its limits.
 type Registry struct {
 	sync.Mutex
-	fonts map[string]fontfind.ScalableFont
+	fonts    map[string]*entry
+	lru      *list.List // entries, most recently used first
+	coverage map[string]*fontfind.Coverage
+	misses   map[string]miss
+	observer observe.Observer
+	limits   Limits
+	size     int64                               // bytes of font data cached
+	onEvict  func(string, fontfind.ScalableFont) // eviction callback, may be nil
+	// revalidation of font files, see SetRevalidation
+	revalidation Revalidation
+	stopPolling  chan struct{} // stops polling for RevalidatePeriodically
+	pollDone     chan struct{} // closed when polling has stopped
+	// fallback fonts, kept apart from the fonts, see SetFallback
+	fallback    Fallback
+	fallbacks   map[fallbackKey]fontfind.ScalableFont
+	fallbackGen int // incremented whenever cached fallback fonts are dropped
+}
+
+// entry is a font cached in a registry.
+type entry struct {
+	key    string
+	font   fontfind.ScalableFont
+	data   []byte        // font data, if loaded (see FontData)
+	id     *fileIdentity // identity of the font file, nil if not a local file
+	pinned bool
+	elem   *list.Element
+}
+
+// miss is a remembered failed lookup.
+type miss struct {
+	reason  error
+	expires time.Time
 }
 
 var globalFontRegistry *Registry
@@ -31,48 +80,93 @@ func GlobalRegistry() *Registry {
 // New creates an empty font registry.
 func New() *Registry {
 	fr := &Registry{
-		fonts: make(map[string]fontfind.ScalableFont),
+		fonts:     make(map[string]*entry),
+		lru:       list.New(),
+		coverage:  make(map[string]*fontfind.Coverage),
+		misses:    make(map[string]miss),
+		fallbacks: make(map[fallbackKey]fontfind.ScalableFont),
 	}
 	return fr
 }
 
-const fallbackFontKey = "fallback"
+// SetObserver sets an observer receiving the registry's events (lookups and
+// stores, see package observe). Passing nil removes the observer.
+func (fr *Registry) SetObserver(obs observe.Observer) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.observer = obs
+}
 
 // StoreFont pushes a font into the registry if it isn't contained yet.
 //
 // The font will be stored using the normalized font name as a key. If this
 // key is already associated with a font, that font will not be overridden.
 func (fr *Registry) StoreFont(normalizedName string, f fontfind.ScalableFont) {
+	fr.store(normalizedName, f)
+}
+
+// store stores a font if the registry does not contain a font for
+// normalizedName, and returns true if it has done so.
+func (fr *Registry) store(normalizedName string, f fontfind.ScalableFont) bool {
 	if f.Name == "" {
 		tracer().Errorf("registry cannot store null font")
-		return
+		return false
 	}
+	return fr.storeIdentified(normalizedName, f, fr.identify(f))
+}
+
+// storeIdentified stores a font like store, recording id as the identity of
+// its font file.
+func (fr *Registry) storeIdentified(normalizedName string, f fontfind.ScalableFont, id *fileIdentity) bool {
 	fr.Lock()
-	defer fr.Unlock()
 	//style, weight := GuessStyleAndWeight(f.Fontname)
 	//fname := NormalizeFontname(f.Fontname, style, weight)
+	stored := false
 	if _, ok := fr.fonts[normalizedName]; !ok {
 		tracer().Debugf("registry stores font %s as %s", f.Name, normalizedName)
-		fr.fonts[normalizedName] = f
+		fr.add(normalizedName, f).id = id
+		stored = true
 	}
+	delete(fr.misses, normalizedName)
+	evicted := fr.evict()
+	obs, onEvict := fr.observer, fr.onEvict
+	fr.Unlock()
+	if stored {
+		observe.Emit(obs, observe.Event{Kind: observe.RegistryStore, Key: normalizedName})
+	}
+	notifyEvicted(evicted, obs, onEvict)
+	return stored
 }
 
 // GetFont returns a cached font by normalized name.
 //
-// On a cache miss, GetFont returns the registry fallback font together with
-// a non-nil error describing the miss.
+// On a cache miss, GetFont returns the registry fallback font of regular style
+// and weight (see FallbackFont) together with a non-nil error describing the
+// miss. With revalidation policy
+// RevalidateOnAccess, a font whose font file has changed is dropped and
+// reported as a miss (see SetRevalidation).
 func (fr *Registry) GetFont(normalizedName string) (fontfind.ScalableFont, error) {
 	//
 	tracer().Debugf("registry searches for font %s", normalizedName)
 	fr.Lock()
-	if t, ok := fr.fonts[normalizedName]; ok {
-		fr.Unlock()
-		tracer().Infof("registry found font %s", normalizedName)
-		return t, nil
+	obs := fr.observer
+	e, ok := fr.fonts[normalizedName]
+	if ok {
+		fr.lru.MoveToFront(e.elem)
 	}
+	onAccess := fr.revalidation.Policy == RevalidateOnAccess
 	fr.Unlock()
+	if ok && onAccess {
+		ok = fr.revalidate(e)
+	}
+	if ok {
+		tracer().Infof("registry found font %s", normalizedName)
+		observe.Emit(obs, observe.Event{Kind: observe.RegistryHit, Key: normalizedName})
+		return e.font, nil
+	}
 	tracer().Infof("registry does not contain font %s", normalizedName)
-	missErr := fmt.Errorf("font %s not found in registry", normalizedName)
+	observe.Emit(obs, observe.Event{Kind: observe.RegistryMiss, Key: normalizedName})
+	missErr := &fontfind.NotFoundError{Name: normalizedName, Source: "registry"}
 	f, fallbackErr := fr.FallbackFont()
 	if fallbackErr != nil {
 		return fontfind.NullFont, fmt.Errorf("%w; fallback failed: %v", missErr, fallbackErr)
@@ -80,58 +174,191 @@ func (fr *Registry) GetFont(normalizedName string) (fontfind.ScalableFont, error
 	return f, missErr
 }
 
-// FallbackFont returns the default fallback font from registry cache.
-// If absent, it will load and cache the packaged fallback under key "fallback".
-func (fr *Registry) FallbackFont() (fontfind.ScalableFont, error) {
+// Coverage returns the Unicode coverage of a cached font by normalized name.
+// Coverage is read from the font's cmap table on first request and cached
+// along with the font.
+//
+// If the registry does not contain a font for normalizedName, Coverage
+// returns an error.
+func (fr *Registry) Coverage(normalizedName string) (*fontfind.Coverage, error) {
 	fr.Lock()
-	if t, ok := fr.fonts[fallbackFontKey]; ok {
+	if c, ok := fr.coverage[normalizedName]; ok {
 		fr.Unlock()
-		return t, nil
+		return c, nil
 	}
+	e, ok := fr.fonts[normalizedName]
 	fr.Unlock()
+	if !ok {
+		return nil, &fontfind.NotFoundError{Name: normalizedName, Source: "registry"}
+	}
+	f := e.font
+	c, err := f.Coverage()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read coverage of font %s: %w", normalizedName, err)
+	}
+	fr.Lock()
+	defer fr.Unlock()
+	// Another goroutine may have computed the coverage while we were reading.
+	if cached, ok := fr.coverage[normalizedName]; ok {
+		return cached, nil
+	}
+	if _, ok := fr.fonts[normalizedName]; ok { // font may have been evicted meanwhile
+		fr.coverage[normalizedName] = c
+	}
+	return c, nil
+}
 
-	f := fontfind.FallbackFont()
+// StoreMiss remembers a failed lookup for a normalized font name, together
+// with the reason of the failure. Misses expire after ttl. Storing a font for
+// the name invalidates the miss as well.
+func (fr *Registry) StoreMiss(normalizedName string, reason error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	if reason == nil {
+		reason = &fontfind.NotFoundError{Name: normalizedName}
+	}
+	fr.Lock()
+	defer fr.Unlock()
+	tracer().Debugf("registry stores miss for %s for %v", normalizedName, ttl)
+	fr.misses[normalizedName] = miss{reason: reason, expires: time.Now().Add(ttl)}
+}
+
+// Miss returns the reason of a remembered failed lookup for a normalized
+// font name, or nil if there is none or if it has expired.
+func (fr *Registry) Miss(normalizedName string) error {
 	fr.Lock()
 	defer fr.Unlock()
-	// Another goroutine may have inserted fallback while we were loading.
-	if t, ok := fr.fonts[fallbackFontKey]; ok {
-		return t, nil
+	m, ok := fr.misses[normalizedName]
+	if !ok {
+		return nil
 	}
-	tracer().Infof("font registry caches fallback font %s", fallbackFontKey)
-	fr.fonts[fallbackFontKey] = f
-	return f, nil
+	if time.Now().After(m.expires) {
+		delete(fr.misses, normalizedName)
+		return nil
+	}
+	return m.reason
+}
+
+// InvalidateMiss forgets a failed lookup for a normalized font name.
+func (fr *Registry) InvalidateMiss(normalizedName string) {
+	fr.Lock()
+	defer fr.Unlock()
+	delete(fr.misses, normalizedName)
+}
+
+// InvalidateMisses forgets all the failed lookups, e.g. after new fonts have
+// been installed.
+func (fr *Registry) InvalidateMisses() {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.misses = make(map[string]miss)
 }
 
 // LogFontList is a helper function to dump the list of fonts known to a
-// registry to the tracer (log-level Info).
+// registry to the tracer (log-level Info). See Snapshot for programmatic
+// access.
 func (fr *Registry) LogFontList(tracer tracing.Trace) {
 	level := tracer.GetTraceLevel()
 	tracer.SetTraceLevel(tracing.LevelInfo)
 	tracer.Infof("--- registered fonts ---")
-	for k, v := range fr.fonts {
-		tracer.Infof("typeface [%s] = %s @ %v", k, v.Name, v.Path)
+	for _, e := range fr.Snapshot() {
+		tracer.Infof("typeface [%s] = %s @ %v", e.Key, e.Font.Name, e.Font.Path())
 	}
 	tracer.Infof("------------------------")
 	tracer.SetTraceLevel(level)
 }
 
-// NormalizeFontname returns a normalized cache key for a font descriptor.
+// NormalizeFontname returns a normalized cache key for a font name, style and weight.
 func NormalizeFontname(fname string, style xfont.Style, weight xfont.Weight) string {
-	fname = strings.TrimSpace(fname)
-	fname = strings.ReplaceAll(fname, " ", "_")
-	if dot := strings.LastIndex(fname, "."); dot > 0 {
-		fname = fname[:dot]
+	return NormalizeDescriptor(fontfind.Descriptor{Pattern: fname, Style: style, Weight: weight})
+}
+
+// NormalizeDescriptor returns a normalized cache key for a font descriptor.
+//
+// Weights other than normal, light and bold are encoded by their numeric
+// value, e.g. "roboto-w900" for black. This includes extra-light, semi-bold
+// and extra-bold, whose keys used to end in "-light" and "-bold": fonts of
+// these weights cached under the former keys will be resolved again.
+//
+// Keys for descriptors requesting a width other than normal, an optical size or
+// variation axis values carry additional suffixes, e.g.
+// "roboto-bold-condensed-opsz12-wght650". Keys for font stacks list the
+// families of the stack, separated by commas, e.g. "noto_serif,serif-italic".
+func NormalizeDescriptor(desc fontfind.Descriptor) string {
+	fname := normalizeFamily(desc.FamilyStack(), desc.Style, desc.Weight)
+	if !desc.Stretch.IsNormal() {
+		if kw := desc.Stretch.Keyword(); kw != "" {
+			fname += "-" + strings.ReplaceAll(kw, "-", "")
+		} else {
+			fname += "-stretch" + formatAxisValue(float32(desc.Stretch))
+		}
+	}
+	if desc.OpticalSize > 0 {
+		fname += "-opsz" + formatAxisValue(desc.OpticalSize)
+	}
+	if len(desc.Variations) > 0 {
+		tags := make([]string, 0, len(desc.Variations))
+		for tag := range desc.Variations {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fname += "-" + strings.TrimSpace(tag) + formatAxisValue(desc.Variations[tag])
+		}
+	}
+	return fname
+}
+
+// keySuffix matches the suffixes appended to the family part of a normalized
+// name by NormalizeDescriptor.
+var keySuffix = func() *regexp.Regexp {
+	var widths []string
+	for wc := 1; wc <= 9; wc++ {
+		if kw := fontfind.StretchFromWidthClass(wc).Keyword(); kw != "normal" && kw != "" {
+			widths = append(widths, strings.ReplaceAll(kw, "-", ""))
+		}
+	}
+	return regexp.MustCompile(`^(.*?)(-italic)?(-light|-bold|-w\d+)?(-(?:` + strings.Join(widths, "|") +
+		`)|-stretch[\d.]+)?(-opsz[\d.]+)?(-[[:alnum:]]{4}-?[\d.]+)*$`)
+}()
+
+// keyFamily returns the family part of a normalized name, i.e. the name
+// without the suffixes for style, weight, width, optical size and variations.
+func keyFamily(key string) string {
+	if m := keySuffix.FindStringSubmatch(key); m != nil {
+		return m[1]
+	}
+	return key
+}
+
+func formatAxisValue(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
+
+func normalizeFamily(families []string, style xfont.Style, weight xfont.Weight) string {
+	names := make([]string, len(families))
+	for i, name := range families {
+		name = strings.TrimSpace(name)
+		name = strings.ReplaceAll(name, " ", "_")
+		if dot := strings.LastIndex(name, "."); dot > 0 {
+			name = name[:dot]
+		}
+		names[i] = strings.ToLower(name)
 	}
-	fname = strings.ToLower(fname)
+	fname := strings.Join(names, ",")
 	switch style {
 	case xfont.StyleItalic, xfont.StyleOblique:
 		fname += "-italic"
 	}
 	switch weight {
-	case xfont.WeightLight, xfont.WeightExtraLight:
+	case xfont.WeightNormal:
+	case xfont.WeightLight:
 		fname += "-light"
-	case xfont.WeightBold, xfont.WeightExtraBold, xfont.WeightSemiBold:
+	case xfont.WeightBold:
 		fname += "-bold"
+	default: // every weight gets a key of its own
+		fname += "-w" + strconv.Itoa(fontfind.WeightClass(weight))
 	}
 	return fname
 }
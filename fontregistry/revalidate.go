@@ -0,0 +1,218 @@
+package fontregistry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
+)
+
+// RevalidationPolicy tells when a registry checks whether the font files of
+// its fonts have changed.
+type RevalidationPolicy int
+
+const (
+	RevalidateNever        RevalidationPolicy = iota // never check font files
+	RevalidateOnAccess                               // check the font file on every GetFont
+	RevalidatePeriodically                           // check all font files in regular intervals
+)
+
+// DefaultRevalidationInterval is the polling interval for policy
+// RevalidatePeriodically, if no interval is configured.
+const DefaultRevalidationInterval = time.Minute
+
+// Revalidation configures the revalidation of fonts loaded from local files
+// (see fontfind.ScalableFont.HostPath). When a font is stored, the registry
+// records the identity of its font file: size, modification time and,
+// optionally, a hash of the contents. Fonts whose font file has been removed
+// or changed are dropped from the registry, so that the resolver pipeline
+// will resolve them again.
+//
+// A font file is considered unchanged if it has the recorded size and
+// modification time. With Hash set, a file with a different modification time
+// but the recorded size and contents is considered unchanged as well.
+type Revalidation struct {
+	Policy   RevalidationPolicy
+	Interval time.Duration // polling interval for RevalidatePeriodically
+	Hash     bool          // record a hash of font files at store time
+}
+
+// SetRevalidation configures the revalidation of fonts. For policy
+// RevalidatePeriodically, a goroutine polls the font files, until the policy
+// is changed again or the registry is closed (see Close). The policy applies
+// to fonts stored before as well, but hashes are recorded only for fonts
+// stored after setting Hash.
+func (fr *Registry) SetRevalidation(r Revalidation) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.stopPoll()
+	fr.revalidation = r
+	if r.Policy == RevalidatePeriodically {
+		interval := r.Interval
+		if interval <= 0 {
+			interval = DefaultRevalidationInterval
+		}
+		fr.stopPolling, fr.pollDone = make(chan struct{}), make(chan struct{})
+		go fr.poll(interval, fr.stopPolling, fr.pollDone)
+	}
+}
+
+// Close stops polling the font files for policy RevalidatePeriodically,
+// which is replaced by RevalidateNever, and waits for a revalidation in
+// progress to finish. A registry remains usable after Close; Close is
+// required only for registries polling their font files, which are not
+// garbage collected otherwise.
+func (fr *Registry) Close() {
+	fr.Lock()
+	done := fr.stopPoll()
+	if fr.revalidation.Policy == RevalidatePeriodically {
+		fr.revalidation.Policy = RevalidateNever
+	}
+	fr.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// stopPoll stops the polling goroutine, if any, and returns a channel which
+// is closed when it has stopped. The caller must hold the lock.
+func (fr *Registry) stopPoll() <-chan struct{} {
+	done := fr.pollDone
+	if fr.stopPolling != nil {
+		close(fr.stopPolling)
+		fr.stopPolling, fr.pollDone = nil, nil
+	}
+	return done
+}
+
+func (fr *Registry) poll(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fr.Revalidate()
+		}
+	}
+}
+
+// Revalidate checks the font files of all the fonts loaded from local files,
+// independent of the revalidation policy, drops fonts whose font file has been
+// removed or changed, and returns the number of fonts dropped.
+func (fr *Registry) Revalidate() int {
+	fr.Lock()
+	entries := make([]*entry, 0, len(fr.fonts))
+	for _, e := range fr.fonts {
+		if e.id != nil {
+			entries = append(entries, e)
+		}
+	}
+	fr.Unlock()
+	n := 0
+	for _, e := range entries {
+		if !fr.revalidate(e) {
+			n++
+		}
+	}
+	return n
+}
+
+// revalidate checks the font file of an entry and drops the entry if the
+// file has changed. It returns false if the entry has been dropped.
+func (fr *Registry) revalidate(e *entry) bool {
+	fr.Lock()
+	id := e.id
+	fr.Unlock()
+	if id == nil || id.current(e.font.HostPath()) {
+		return true
+	}
+	tracer().Infof("font file %s of font %s has changed", e.font.HostPath(), e.key)
+	fr.Lock()
+	if cur, ok := fr.fonts[e.key]; ok && cur == e { // entry may have been replaced meanwhile
+		fr.remove(e)
+	}
+	obs := fr.observer
+	fr.Unlock()
+	observe.Emit(obs, observe.Event{Kind: observe.RegistryInvalidate, Key: e.key, Source: e.font.HostPath()})
+	return false
+}
+
+// identify returns the identity of a font's file, or nil if the font has not
+// been loaded from a local file.
+func (fr *Registry) identify(f fontfind.ScalableFont) *fileIdentity {
+	if f.HostPath() == "" {
+		return nil
+	}
+	fr.Lock()
+	withHash := fr.revalidation.Hash
+	fr.Unlock()
+	id, err := statFile(f.HostPath(), withHash)
+	if err != nil {
+		tracer().Errorf("cannot identify font file %s: %v", f.HostPath(), err)
+		return nil
+	}
+	return &id
+}
+
+// --- File identity ---------------------------------------------------------
+
+// fileIdentity identifies the contents of a font file.
+type fileIdentity struct {
+	size    int64
+	modTime time.Time
+	hash    string // hex encoded SHA-256 of the file's contents, may be empty
+}
+
+// statFile returns the identity of a font file. If withHash is set, the
+// file's contents are hashed.
+func statFile(path string, withHash bool) (fileIdentity, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	id := fileIdentity{size: info.Size(), modTime: info.ModTime()}
+	if withHash {
+		if id.hash, err = hashFile(path); err != nil {
+			return fileIdentity{}, err
+		}
+	}
+	return id, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// current checks if the file at path still has identity id. Files of the same
+// size, but with a different modification time, are compared by hash, if id
+// has one.
+func (id fileIdentity) current(path string) bool {
+	cur, err := statFile(path, false)
+	if err != nil || cur.size != id.size {
+		return false
+	}
+	if cur.modTime.Equal(id.modTime) {
+		return true
+	}
+	if id.hash == "" {
+		return false
+	}
+	hash, err := hashFile(path)
+	return err == nil && hash == id.hash
+}
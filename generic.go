@@ -0,0 +1,44 @@
+package fontfind
+
+import "strings"
+
+// Generic font families, as of CSS Fonts Level 4 (section 4.1.1). A generic
+// family is not a font family by itself, but stands for a category of fonts.
+// Generic families are resolved by alias rules (see DefaultAliases), which map
+// them to an ordered list of concrete families, and by locators knowing font
+// categories (e.g., the Google Fonts directory).
+const (
+	GenericSerif     = "serif"
+	GenericSansSerif = "sans-serif"
+	GenericMonospace = "monospace"
+	GenericCursive   = "cursive"
+	GenericEmoji     = "emoji"
+	GenericMath      = "math"
+)
+
+// GenericFamily returns the generic family name for a family, if family is
+// a generic family keyword (case-insensitive).
+func GenericFamily(family string) (string, bool) {
+	switch generic := strings.ToLower(strings.TrimSpace(family)); generic {
+	case GenericSerif, GenericSansSerif, GenericMonospace, GenericCursive, GenericEmoji, GenericMath:
+		return generic, true
+	}
+	return "", false
+}
+
+// IsGenericFamily returns true if family is a generic family keyword.
+func IsGenericFamily(family string) bool {
+	_, ok := GenericFamily(family)
+	return ok
+}
+
+// builtinGenerics map generic families to widespread free families, which are
+// preferred to fonts of the generic family's category.
+var builtinGenerics = []Alias{
+	{Family: GenericSerif, Prefer: []string{"Noto Serif", "DejaVu Serif", "Liberation Serif", "Times New Roman"}},
+	{Family: GenericSansSerif, Prefer: []string{"Noto Sans", "DejaVu Sans", "Liberation Sans", "Arial"}},
+	{Family: GenericMonospace, Prefer: []string{"Noto Sans Mono", "DejaVu Sans Mono", "Liberation Mono", "Courier New"}},
+	{Family: GenericCursive, Prefer: []string{"Apple Chancery", "Comic Sans MS", "TeX Gyre Chorus", "Dancing Script"}},
+	{Family: GenericEmoji, Prefer: []string{"Noto Color Emoji", "Apple Color Emoji", "Segoe UI Emoji", "Twemoji Mozilla"}},
+	{Family: GenericMath, Prefer: []string{"STIX Two Math", "Latin Modern Math", "Cambria Math", "Noto Sans Math"}},
+}
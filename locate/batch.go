@@ -0,0 +1,102 @@
+package locate
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/fontregistry"
+)
+
+// DefaultConcurrency is the number of searches ResolveAll runs in parallel,
+// if not configured otherwise with WithConcurrency.
+const DefaultConcurrency = 8
+
+// Resolution is the result of resolving a single descriptor of a batch.
+// As with Resolve, Font is the registry fallback font if the descriptor could
+// not be resolved.
+type Resolution struct {
+	Descriptor fontfind.Descriptor
+	Font       fontfind.ScalableFont
+	Err        error
+	Report     *Report // nil if the search has not been run
+}
+
+// WithConcurrency returns a copy of a pipeline which runs at most n searches in
+// parallel in ResolveAll. If n is less than 1, DefaultConcurrency is used.
+func (pipeline ResolverPipeline) WithConcurrency(n int) ResolverPipeline {
+	pipeline.concurrency = n
+	return pipeline
+}
+
+// ResolveAll resolves a batch of descriptors, e.g. the fonts of a document,
+// and blocks until all of them are resolved or ctx is done. Use a context with
+// a deadline to limit the time spent for the whole batch.
+//
+// Descriptors with the same normalized name are resolved once. Searches run
+// in parallel, up to the pipeline's concurrency limit (see WithConcurrency).
+//
+// ResolveAll returns a resolution for every descriptor, in the order of descs.
+// If some of the descriptors could not be resolved, the error returned is the
+// join of their errors (see errors.Join), and the resolutions for the failed
+// descriptors carry their individual errors. Descriptors not resolved when
+// ctx is done fail with ctx's error.
+func (pipeline ResolverPipeline) ResolveAll(ctx context.Context, descs []fontfind.Descriptor) ([]Resolution, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	registry := pipeline.registry
+	if registry == nil {
+		registry = fontregistry.GlobalRegistry()
+	}
+	limit := pipeline.concurrency
+	if limit < 1 {
+		limit = DefaultConcurrency
+	}
+	// deduplicate descriptors
+	var unique []int                // index of first descriptor for every name
+	slot := make([]int, len(descs)) // position in unique for every descriptor
+	seen := make(map[string]int)
+	for i, desc := range descs {
+		name := fontregistry.NormalizeDescriptor(desc)
+		if pos, ok := seen[name]; ok {
+			slot[i] = pos
+			continue
+		}
+		seen[name] = len(unique)
+		slot[i] = len(unique)
+		unique = append(unique, i)
+	}
+	// run searches with bounded concurrency
+	results := make([]fontPlusErr, len(unique))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for pos, i := range unique {
+		wg.Add(1)
+		go func(pos int, desc fontfind.Descriptor) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				results[pos] = pipeline.search(ctx, registry, desc)
+			case <-ctx.Done():
+				results[pos] = fontPlusErr{err: fontfind.Cancelled(ctx.Err())}
+			}
+		}(pos, descs[i])
+	}
+	wg.Wait()
+	//
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+	resolutions := make([]Resolution, len(descs))
+	for i, desc := range descs {
+		r := results[slot[i]]
+		resolutions[i] = Resolution{Descriptor: desc, Font: r.font, Err: r.err, Report: r.report}
+	}
+	return resolutions, errors.Join(errs...)
+}
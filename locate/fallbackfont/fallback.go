@@ -2,7 +2,6 @@ package fallbackfont
 
 import (
 	"embed"
-	"errors"
 
 	"github.com/npillmayer/fontfind"
 	"github.com/npillmayer/fontfind/locate"
@@ -21,12 +20,15 @@ var packaged embed.FS
 const defaultFallbackFilename = "Go-Regular.otf"
 
 // Find creates a locator that resolves fonts from the embedded fallback set.
+// Other than FindFallbackFont, the locator reports requests not matching any
+// packaged font as not found, so that resolver chains go on searching.
 func Find() locate.FontLocator {
 	return func(descr fontfind.Descriptor) (fontfind.ScalableFont, error) {
-		pattern := descr.Pattern
-		style := descr.Style
-		weight := descr.Weight
-		return FindFallbackFont(pattern, style, weight)
+		f, err := findFallbackFont(descr)
+		if err == nil && f.Confidence == fontfind.NoConfidence {
+			return fontfind.NullFont, &fontfind.NotFoundError{Name: descr.Pattern, Source: string(fontfind.SourceEmbedded)}
+		}
+		return f, err
 	}
 }
 
@@ -38,9 +40,12 @@ func Default() (fontfind.ScalableFont, error) {
 	}
 	path := "packaged/" + defaultFallbackFilename
 	sfnt := fontfind.ScalableFont{
-		Name:   defaultFallbackFilename,
-		Style:  font.StyleNormal,
-		Weight: font.WeightNormal,
+		Name:       defaultFallbackFilename,
+		Family:     "Go",
+		Style:      font.StyleNormal,
+		Weight:     font.WeightNormal,
+		Confidence: fontfind.PerfectConfidence,
+		Source:     fontfind.SourceEmbedded,
 	}
 	sfnt.SetFS(packaged, path)
 	return sfnt, nil
@@ -49,27 +54,55 @@ func Default() (fontfind.ScalableFont, error) {
 // FindFallbackFont looks up a matching font in embedded fallback resources.
 // If no match exists, it returns the first available packaged font.
 func FindFallbackFont(pattern string, style font.Style, weight font.Weight) (fontfind.ScalableFont, error) {
+	return findFallbackFont(fontfind.Descriptor{Pattern: pattern, Style: style, Weight: weight})
+}
+
+// genericFallbacks are the packaged families used for generic families.
+var genericFallbacks = map[string]string{
+	fontfind.GenericSerif:     "Gentium",
+	fontfind.GenericSansSerif: "Go",
+	fontfind.GenericMonospace: "Go Mono",
+}
+
+func findFallbackFont(desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+	if generic, ok := fontfind.GenericFamily(desc.Pattern); ok {
+		family, ok := genericFallbacks[generic]
+		if !ok {
+			return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern, Source: string(fontfind.SourceEmbedded)}
+		}
+		desc.Pattern = family
+	}
 	fonts, _ := packaged.ReadDir("packaged")
-	var fname string // path to embedded font, if any
+	var fname string           // path to embedded font, if any
+	var face fontfind.FaceInfo // metadata of the selected face
+	confidence := fontfind.NoConfidence
 	for _, f := range fonts {
 		if f.IsDir() {
 			continue
 		}
-		if fontfind.Matches(f.Name(), pattern, style, weight) {
-			tracer().Debugf("found embedded font file %s", f.Name())
-			fname = f.Name()
+		data, err := packaged.ReadFile("packaged/" + f.Name())
+		if err != nil {
+			continue
+		}
+		fi, c := fontfind.MatchFontFile(data, f.Name(), desc)
+		if fname == "" || c > confidence {
+			fname, face, confidence = f.Name(), fi, c
+		}
+		if confidence == fontfind.PerfectConfidence {
+			tracer().Debugf("found embedded font file %s, face #%d", f.Name(), fi.Index)
 			break
 		}
-		fname = f.Name()
 	}
-	var sFont fontfind.ScalableFont
 	if fname == "" {
-		return fontfind.NullFont, errors.New("font not found")
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern, Source: string(fontfind.SourceEmbedded)}
+	}
+	sFont := fontfind.ScalableFont{
+		Name:       fname,
+		Confidence: confidence,
+		Source:     fontfind.SourceEmbedded,
 	}
-	// font is packaged embedded font
-	sFont.Name = fname
-	sFont.Style = style
-	sFont.Weight = weight
 	sFont.SetFS(packaged, "packaged/"+fname)
+	sFont.SetMetadata(face)
+	sFont.SelectInstance(desc)
 	return sFont, nil
 }
@@ -0,0 +1,90 @@
+package locate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/npillmayer/fontfind"
+)
+
+// flightGroup coalesces concurrent searches for the same font: while a search
+// for a normalized font name is in flight, further requests for the name wait
+// for its result instead of running the resolvers again.
+//
+// A search is shared by all of its waiters. It is cancelled only after every
+// waiter has given up, i.e. a caller cancelling its context does not affect
+// other callers waiting for the same font.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a search in progress.
+type flight struct {
+	done    chan struct{}
+	result  fontPlusErr
+	waiters int                // number of callers waiting for the result
+	cancel  context.CancelFunc // cancels the search
+}
+
+// search runs a search for a normalized font name, sharing it with concurrent
+// callers requesting the same font. The search is run with a context carrying
+// the values, but not the cancellation, of ctx.
+func (group *flightGroup) search(ctx context.Context, name string, search func(context.Context) fontPlusErr) fontPlusErr {
+	if err := ctx.Err(); err != nil {
+		return fontPlusErr{err: fontfind.Cancelled(err)}
+	}
+	group.mu.Lock()
+	if group.flights == nil {
+		group.flights = make(map[string]*flight)
+	}
+	f, ok := group.flights[name]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		group.flights[name] = f
+		go func() {
+			defer cancel()
+			f.result = search(flightCtx)
+			group.mu.Lock()
+			if group.flights[name] == f {
+				delete(group.flights, name)
+			}
+			group.mu.Unlock()
+			close(f.done)
+		}()
+	} else {
+		tracer().Debugf("joining search in flight for font %s", name)
+	}
+	f.waiters++
+	group.mu.Unlock()
+	//
+	select {
+	case <-f.done:
+		result := f.result
+		if ok && result.report != nil { // joined a search of another caller
+			report := *result.report
+			report.Shared = true
+			result.report = &report
+		}
+		return result
+	case <-ctx.Done():
+		group.leave(name, f)
+		return fontPlusErr{err: fontfind.Cancelled(ctx.Err())}
+	}
+}
+
+// leave is called by a waiter giving up on a flight. The last waiter leaving
+// cancels the search.
+func (group *flightGroup) leave(name string, f *flight) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	if group.flights[name] == f { // new requests must not join a cancelled search
+		delete(group.flights, name)
+	}
+	f.cancel()
+}
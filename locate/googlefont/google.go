@@ -1,8 +1,11 @@
 package googlefont
 
 import (
+	"context"
+
 	"github.com/npillmayer/fontfind"
 	"github.com/npillmayer/fontfind/locate"
+	"github.com/npillmayer/fontfind/observe"
 	"github.com/npillmayer/schuko"
 	"github.com/npillmayer/schuko/schukonf/testconfig"
 	"github.com/npillmayer/schuko/tracing"
@@ -22,10 +25,21 @@ var USE_SYSTEM_IO IO = nil
 func Find(conf schuko.Configuration, hostio IO) locate.FontLocator {
 	svc := newGoogleService(hostio)
 	return func(descr fontfind.Descriptor) (fontfind.ScalableFont, error) {
-		pattern := descr.Pattern
-		style := descr.Style
-		weight := descr.Weight
-		return svc.findGoogleFont(conf, pattern, style, weight)
+		return svc.findFont(conf, descr, nil)
+	}
+}
+
+// FindWithContext creates a context-aware FontLocator for Google Fonts.
+// Font downloads are reported to the observer carried by the context (see
+// observe.WithObserver), which is set by a resolver pipeline configured with
+// an observer.
+func FindWithContext(conf schuko.Configuration, hostio IO) locate.FontLocatorWithContext {
+	svc := newGoogleService(hostio)
+	return func(ctx context.Context, descr fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		if err := ctx.Err(); err != nil {
+			return fontfind.NullFont, fontfind.Cancelled(err)
+		}
+		return svc.findFont(conf, descr, observe.FromContext(ctx))
 	}
 }
 
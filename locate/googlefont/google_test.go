@@ -2,6 +2,7 @@ package googlefont
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"io/fs"
 	"net/http"
@@ -11,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
 	"github.com/npillmayer/schuko/schukonf/testconfig"
 	"golang.org/x/image/font"
 )
@@ -111,6 +114,9 @@ func TestGoogleAPI(t *testing.T) {
 	if !strings.Contains(url, "sort=alpha") {
 		t.Fatalf("expected sort=alpha in request URL, got %q", url)
 	}
+	if !strings.Contains(url, "capability=VF") {
+		t.Fatalf("expected capability=VF in request URL, got %q", url)
+	}
 }
 
 func TestMatchFontname(t *testing.T) {
@@ -157,6 +163,100 @@ func TestGoogleFindFont(t *testing.T) {
 	if f.Path() != "Anonymous Pro-italic.ttf" {
 		t.Fatalf("expected italic variant, got %q", f.Path())
 	}
+	if f.Family != "Anonymous Pro" || f.Style != font.StyleItalic || f.Source != fontfind.SourceGoogle {
+		t.Fatalf("expected Anonymous Pro italic from Google, got %q style=%d from %q", f.Family, f.Style, f.Source)
+	}
+}
+
+func TestGoogleFindWidthVariant(t *testing.T) {
+	hostio := newFakeIO(t)
+	svc := newGoogleService(hostio)
+	conf := testconfig.Conf{
+		"app-key": "tyse-test",
+	}
+	desc := fontfind.Descriptor{Pattern: "Roboto", Weight: font.WeightNormal}
+	f, err := svc.findFont(conf, desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Family != "Roboto" || !f.Stretch.IsNormal() {
+		t.Fatalf("expected Roboto of normal width, got %q (stretch %v)", f.Family, f.Stretch)
+	}
+	desc.Stretch = fontfind.StretchSemiCondensed
+	f, err = svc.findFont(conf, desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Family != "Roboto Condensed" || f.Stretch != fontfind.StretchCondensed {
+		t.Fatalf("expected Roboto Condensed, got %q (stretch %v)", f.Family, f.Stretch)
+	}
+	if f.Path() != "Roboto Condensed-regular.ttf" {
+		t.Fatalf("expected regular variant, got %q", f.Path())
+	}
+}
+
+func TestGoogleFindBoldWidthVariant(t *testing.T) {
+	hostio := newFakeIO(t)
+	svc := newGoogleService(hostio)
+	conf := testconfig.Conf{
+		"app-key": "tyse-test",
+	}
+	desc := fontfind.Descriptor{Pattern: "Roboto", Weight: font.WeightBold, Stretch: fontfind.StretchSemiCondensed}
+	f, err := svc.findFont(conf, desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Family != "Roboto Condensed" || f.Path() != "Roboto Condensed-700.ttf" {
+		t.Fatalf("expected bold variant of Roboto Condensed, got %q of %q", f.Path(), f.Family)
+	}
+}
+
+func TestGoogleFindGenericFamily(t *testing.T) {
+	hostio := newFakeIO(t)
+	svc := newGoogleService(hostio)
+	conf := testconfig.Conf{
+		"app-key": "tyse-test",
+	}
+	fi, err := svc.matchGoogleFontInfo(conf, "monospace", font.StyleItalic, font.WeightNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi[0].Family != "Anonymous Pro" || fi[0].Category != "monospace" {
+		t.Errorf("expected monospace family Anonymous Pro, got %q (%s)", fi[0].Family, fi[0].Category)
+	}
+	desc := fontfind.Descriptor{Pattern: fontfind.GenericMath}
+	if _, err = svc.findFont(conf, desc, nil); !errors.Is(err, fontfind.ErrNotFound) {
+		t.Errorf("expected no Google category for generic family math, got %v", err)
+	}
+}
+
+func TestGoogleFindVariableFont(t *testing.T) {
+	hostio := newFakeIO(t)
+	svc := newGoogleService(hostio)
+	conf := testconfig.Conf{
+		"app-key": "tyse-test",
+	}
+	desc := fontfind.Descriptor{
+		Pattern:    "Inconsolata",
+		Weight:     font.WeightBold,
+		Stretch:    fontfind.StretchSemiExpanded,
+		Variations: map[string]float32{"wght": 650},
+	}
+	f, err := svc.findFont(conf, desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Path() != "Inconsolata-regular.ttf" || !f.IsVariable() {
+		t.Fatalf("expected variable font file for regular variant, got %q", f.Path())
+	}
+	coords := f.Coordinates()
+	if coords["wght"] != 650 || coords["wdth"] != 112.5 {
+		t.Errorf("expected coordinates wght=650 wdth=112.5, got %v", coords)
+	}
+	if f.Confidence != fontfind.PerfectConfidence || f.Stretch != fontfind.StretchSemiExpanded {
+		t.Errorf("expected perfect match of semi-expanded instance, got confidence %d, stretch %v",
+			f.Confidence, f.Stretch)
+	}
 }
 
 func TestGoogleCacheFont(t *testing.T) {
@@ -169,10 +269,15 @@ func TestGoogleCacheFont(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	cachedir, file, err := svc.cacheGoogleFont(conf, fi[0], "regular")
+	stats := observe.NewStats()
+	cachedir, file, err := svc.cacheGoogleFont(conf, fi[0], "regular", stats)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if snap := stats.Snapshot(); snap.Counts[observe.Download] != 1 || snap.DownloadBytes != int64(len(hostio.fontBytes)) {
+		t.Errorf("expected download of %d bytes to be observed, got %d downloads, %d bytes",
+			len(hostio.fontBytes), snap.Counts[observe.Download], snap.DownloadBytes)
+	}
 	p := filepath.Join(cachedir, file)
 	b, err := os.ReadFile(p)
 	if err != nil {
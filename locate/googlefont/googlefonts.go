@@ -7,22 +7,95 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/observe"
 	"github.com/npillmayer/schuko"
 	"github.com/npillmayer/schuko/tracing"
 	font "golang.org/x/image/font"
 )
 
 // GoogleFontInfo describes a font entry in the Google Font Service.
+//
+// For variable font families, Axes lists the ranges of the family's variation
+// axes. The files of these families are variable fonts, with a single file per
+// style covering every weight (and width) within the ranges of the axes.
+//
+// Category is the family's classification, one of "serif", "sans-serif",
+// "display", "handwriting" and "monospace".
 type GoogleFontInfo struct {
 	fontfind.FontVariantsLocation
-	Version string            `json:"version"`
-	Subsets []string          `json:"subsets"`
-	Files   map[string]string `json:"files"`
+	Category string            `json:"category"`
+	Version  string            `json:"version"`
+	Subsets  []string          `json:"subsets"`
+	Files    map[string]string `json:"files"`
+	Axes     []GoogleAxis      `json:"axes"`
+}
+
+// GoogleAxis is a variation axis of a variable font family in the Google Font
+// Service.
+type GoogleAxis struct {
+	Tag   string  `json:"tag"`
+	Start float32 `json:"start"`
+	End   float32 `json:"end"`
+}
+
+// variationAxes converts the axes of a variable font family. Default values
+// are not published by the Google Font Service and are set to the start of
+// an axis' range.
+func (fi GoogleFontInfo) variationAxes() []fontfind.Axis {
+	axes := make([]fontfind.Axis, len(fi.Axes))
+	for i, a := range fi.Axes {
+		axes[i] = fontfind.Axis{Tag: a.Tag, Min: a.Start, Default: a.Start, Max: a.End}
+	}
+	return axes
+}
+
+// variantProperties returns the properties of the variants of a font family
+// for font matching. Variants of variable font families cover the ranges of
+// the family's wght and wdth axes.
+func (fi GoogleFontInfo) variantProperties() []fontfind.FaceProperties {
+	props := make([]fontfind.FaceProperties, len(fi.Variants))
+	for i, v := range fi.Variants {
+		fp := fontfind.VariantProperties(v, fi.FamilyStretch())
+		for _, a := range fi.variationAxes() {
+			switch a.Tag {
+			case fontfind.AxisWeight:
+				fp.WeightMin, fp.WeightMax = a.Min, a.Max
+			case fontfind.AxisWidth:
+				fp.StretchMin, fp.StretchMax = fontfind.Stretch(a.Min), fontfind.Stretch(a.Max)
+			}
+		}
+		props[i] = fp
+	}
+	return props
+}
+
+// selectVariant selects the variant of a font family closest to desc,
+// following the CSS font matching algorithm (see fontfind.FindClosestFace).
+func (fi GoogleFontInfo) selectVariant(desc fontfind.Descriptor) (string, fontfind.MatchConfidence) {
+	i, confidence := fontfind.FindClosestFace(fi.variantProperties(), desc)
+	if i < 0 {
+		return "", fontfind.NoConfidence
+	}
+	return fi.Variants[i], confidence
+}
+
+// familyStretch returns the width of a font family closest to a requested
+// stretch. For families with a wdth axis, this is the requested stretch,
+// clamped to the range of the axis.
+func (fi GoogleFontInfo) familyStretch(requested fontfind.Stretch) fontfind.Stretch {
+	for _, a := range fi.variationAxes() {
+		if a.Tag == fontfind.AxisWidth {
+			return fontfind.Stretch(a.Clamp(float32(requested.Normalized())))
+		}
+	}
+	return fi.FamilyStretch()
 }
 
 type googleFontsList struct {
@@ -64,31 +137,39 @@ func (svc *googleService) setupGoogleFontsDirectory(conf schuko.Configuration) (
 		if apikey == "" {
 			if apikey = svc.io.Getenv("GOOGLE_FONTS_API_KEY"); apikey == "" {
 				tracer().Errorf("Google fonts API key not set")
-				svc.googleFontsLoadErr = fmt.Errorf(`Google Fonts API-key must be set in global configuration or as GOOGLE_FONTS_API_KEY in environment;
-      please refer to https://developers.google.com/fonts/docs/developer_api`)
+				svc.googleFontsLoadErr = &fontfind.SourceError{Source: string(fontfind.SourceGoogle),
+					Err: errors.New(`Google Fonts API-key must be set in global configuration or as GOOGLE_FONTS_API_KEY in environment;
+      please refer to https://developers.google.com/fonts/docs/developer_api`)}
 				return
 			}
 		}
 		values := url.Values{
-			"sort": []string{"alpha"},
-			"key":  []string{apikey},
+			"sort":       []string{"alpha"},
+			"key":        []string{apikey},
+			"capability": []string{"VF"}, // include variation axes and variable font files
 		}
 		resp, getErr := svc.io.HTTPGet(svc.api + values.Encode())
 		if getErr != nil || resp == nil {
 			tracer().Errorf("Google Fonts API request not OK, error = %v", getErr)
-			svc.googleFontsLoadErr = fmt.Errorf("could not get fonts-directory from Google font service")
+			if getErr == nil {
+				getErr = errors.New("no response")
+			}
+			svc.googleFontsLoadErr = &fontfind.SourceError{Source: string(fontfind.SourceGoogle),
+				Err: fmt.Errorf("could not get fonts-directory from Google font service: %w", getErr)}
 			return
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
 			tracer().Errorf("Google Fonts API request not OK, status = %d", resp.StatusCode)
-			svc.googleFontsLoadErr = fmt.Errorf("could not get fonts-directory from Google font service")
+			svc.googleFontsLoadErr = &fontfind.SourceError{Source: string(fontfind.SourceGoogle),
+				Err: fmt.Errorf("could not get fonts-directory from Google font service: %s", resp.Status)}
 			return
 		}
 		var list googleFontsList
 		dec := json.NewDecoder(resp.Body)
 		if decErr := dec.Decode(&list); decErr != nil {
-			svc.googleFontsLoadErr = fmt.Errorf("could not decode fonts-list from Google font service")
+			svc.googleFontsLoadErr = &fontfind.SourceError{Source: string(fontfind.SourceGoogle),
+				Err: fmt.Errorf("could not decode fonts-list from Google font service: %w", decErr)}
 			return
 		}
 		svc.googleFontsDir = list
@@ -108,43 +189,50 @@ func FindGoogleFont(conf schuko.Configuration, pattern string, style font.Style,
 func (svc *googleService) findGoogleFont(conf schuko.Configuration, pattern string, style font.Style, weight font.Weight) (
 	fontfind.ScalableFont, error) {
 	//
-	fiList, err := svc.matchGoogleFontInfo(conf, pattern, style, weight)
+	desc := fontfind.Descriptor{Pattern: pattern, Style: style, Weight: weight}
+	return svc.findFont(conf, desc, nil)
+}
+
+// findFont resolves a Google font for a descriptor. Downloads are reported to
+// obs, which may be nil.
+func (svc *googleService) findFont(conf schuko.Configuration, desc fontfind.Descriptor, obs observe.Observer) (
+	fontfind.ScalableFont, error) {
+	//
+	fiList, err := svc.matchFontInfo(conf, desc)
 	if err != nil {
 		return fontfind.NullFont, err
 	}
 	if len(fiList) == 0 {
-		return fontfind.NullFont, fmt.Errorf("no matching Google font found")
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern, Source: string(fontfind.SourceGoogle)}
 	}
 	fi := fiList[0]
-	variant, confidence := selectVariant(fi.Variants, style, weight)
+	variant, confidence := fi.selectVariant(desc)
 	if confidence < fontfind.LowConfidence {
-		return fontfind.NullFont, fmt.Errorf("no suitable variant for %s (confidence=%d)", fi.Family, confidence)
+		return fontfind.NullFont, fmt.Errorf("no suitable variant for %s (confidence=%d): %w", fi.Family, confidence,
+			fontfind.ErrNotFound)
 	}
-	cachedir, name, err := svc.cacheGoogleFont(conf, fi, variant)
+	cachedir, name, err := svc.cacheGoogleFont(conf, fi, variant, obs)
 	if err != nil {
 		return fontfind.NullFont, err
 	}
 	fsys := svc.io.DirFS(cachedir)
 	sfnt := fontfind.ScalableFont{
-		Name:   name,
-		Style:  style,
-		Weight: weight,
+		Name:       name,
+		Family:     fi.Family,
+		Confidence: confidence,
+		Source:     fontfind.SourceGoogle,
 	}
+	sfnt.Style, sfnt.Weight = fontfind.VariantStyleAndWeight(variant)
+	sfnt.Stretch = fi.familyStretch(desc.Stretch)
 	sfnt.SetFS(fsys, name)
-	return sfnt, nil
-}
-
-func selectVariant(variants []string, style font.Style, weight font.Weight) (variant string, confidence fontfind.MatchConfidence) {
-	for _, v := range variants {
-		s := fontfind.MatchStyle(v, style)
-		w := fontfind.MatchWeight(v, weight)
-		c := (s + w) / 2
-		if c > confidence {
-			confidence = c
-			variant = v
-		}
+	sfnt.SetHostPath(filepath.Join(cachedir, name))
+	if meta, err := sfnt.Metadata(); err == nil {
+		sfnt.SetMetadata(meta)
+	} else if len(fi.Axes) > 0 {
+		sfnt.SetVariation(fontfind.Variation{Axes: fi.variationAxes()})
 	}
-	return
+	sfnt.SelectInstance(desc)
+	return sfnt, nil
 }
 
 // matchGoogleFontInfo scans the Google Font Service for fonts matching pattern and
@@ -161,30 +249,73 @@ func matchGoogleFontInfo(conf schuko.Configuration, pattern string, style font.S
 }
 
 func (svc *googleService) matchGoogleFontInfo(conf schuko.Configuration, pattern string, style font.Style, weight font.Weight) (
+	[]GoogleFontInfo, error) {
+	//
+	desc := fontfind.Descriptor{Pattern: pattern, Style: style, Weight: weight}
+	return svc.matchFontInfo(conf, desc)
+}
+
+// googleCategories maps generic families to Google font categories. There are
+// no categories for the generic families "emoji" and "math".
+var googleCategories = map[string]string{
+	fontfind.GenericSerif:     "serif",
+	fontfind.GenericSansSerif: "sans-serif",
+	fontfind.GenericMonospace: "monospace",
+	fontfind.GenericCursive:   "handwriting",
+}
+
+// matchFontInfo scans the Google Font Service for font families matching a
+// descriptor. Width variants of a family are published as separate families,
+// e.g. "Roboto Condensed", therefore the families with the width closest to
+// the requested one are selected (see fontfind.ClosestStretch).
+//
+// A generic family (see fontfind.GenericFamily) is matched by the category of
+// font families instead of by name.
+func (svc *googleService) matchFontInfo(conf schuko.Configuration, desc fontfind.Descriptor) (
 	[]GoogleFontInfo, error) {
 	//
 	var fiList []GoogleFontInfo
 	if err := svc.setupGoogleFontsDirectory(conf); err != nil {
 		return fiList, err
 	}
-	r, err := regexp.Compile(strings.ToLower(pattern))
-	if err != nil {
-		return fiList, fmt.Errorf("cannot match Google font: invalid font name pattern: %v", err)
+	pattern := desc.Pattern
+	var matches func(GoogleFontInfo) bool
+	if generic, ok := fontfind.GenericFamily(pattern); ok {
+		category, ok := googleCategories[generic]
+		if !ok {
+			return fiList, &fontfind.NotFoundError{Name: pattern, Source: string(fontfind.SourceGoogle)}
+		}
+		tracer().Debugf("trying to match category (%s)", category)
+		matches = func(finfo GoogleFontInfo) bool { return finfo.Category == category }
+	} else {
+		r, err := regexp.Compile(strings.ToLower(pattern))
+		if err != nil {
+			return fiList, &fontfind.PatternError{Pattern: pattern, Err: err}
+		}
+		tracer().Debugf("trying to match (%s)", strings.ToLower(pattern))
+		matches = func(finfo GoogleFontInfo) bool { return r.MatchString(strings.ToLower(finfo.Family)) }
 	}
-	tracer().Debugf("trying to match (%s)", strings.ToLower(pattern))
+	var candidates []GoogleFontInfo
+	var widths []fontfind.Stretch
 	for _, finfo := range svc.googleFontsDir.Items {
-		if r.MatchString(strings.ToLower(finfo.Family)) {
+		if matches(finfo) {
 			tracer().Debugf("Google font name matches pattern: %s", finfo.Family)
-			_, _, confidence := fontfind.ClosestMatch([]fontfind.FontVariantsLocation{finfo.FontVariantsLocation}, pattern,
-				style, weight)
+			_, confidence := finfo.selectVariant(desc)
 			if confidence > fontfind.LowConfidence {
-				fiList = append(fiList, finfo)
-				break
+				candidates = append(candidates, finfo)
+				widths = append(widths, finfo.familyStretch(desc.Stretch))
 			}
 		}
 	}
+	stretch := fontfind.ClosestStretch(widths, desc.Stretch)
+	for i, finfo := range candidates {
+		if widths[i] == stretch {
+			fiList = append(fiList, finfo)
+			break
+		}
+	}
 	if len(fiList) == 0 {
-		return fiList, errors.New("no Google font matches pattern")
+		return fiList, &fontfind.NotFoundError{Name: pattern, Source: string(fontfind.SourceGoogle)}
 	}
 	tracer().Debugf("found Google font: %v", fiList[0])
 	return fiList, nil
@@ -193,8 +324,10 @@ func (svc *googleService) matchGoogleFontInfo(conf schuko.Configuration, pattern
 // ---------------------------------------------------------------------------
 
 // cacheGoogleFont loads a font described by fi with a given variant.
-// The loaded font is cached in the user's cache directory.
-func (svc *googleService) cacheGoogleFont(conf schuko.Configuration, fi GoogleFontInfo, variant string) (
+// The loaded font is cached in the user's cache directory. Downloads are
+// reported to obs, which may be nil.
+func (svc *googleService) cacheGoogleFont(conf schuko.Configuration, fi GoogleFontInfo, variant string,
+	obs observe.Observer) (
 	cachedir, name string, err error) {
 	//
 	var fileurl string
@@ -218,7 +351,13 @@ func (svc *googleService) cacheGoogleFont(conf schuko.Configuration, fi GoogleFo
 	if _, err := svc.io.Stat(filepath); err == nil {
 		tracer().Infof("font already cached: %s", filepath)
 	} else {
+		start := time.Now()
 		err = downloadCachedFile(svc.io, filepath, fileurl)
+		event := observe.Event{Kind: observe.Download, Source: fileurl, Duration: time.Since(start), Err: err}
+		if info, statErr := svc.io.Stat(filepath); err == nil && statErr == nil {
+			event.Bytes = info.Size()
+		}
+		observe.Emit(obs, event)
 	}
 	return
 }
@@ -7,8 +7,14 @@ import (
 	"context"
 
 	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/schuko/tracing"
 )
 
+// tracer writes to trace with key 'tyse.font'
+func tracer() tracing.Trace {
+	return tracing.Select("tyse.font")
+}
+
 // FontLocator resolves a scalable font for a descriptor.
 type FontLocator func(fontfind.Descriptor) (fontfind.ScalableFont, error)
 
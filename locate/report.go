@@ -0,0 +1,113 @@
+package locate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/npillmayer/fontfind"
+)
+
+// Report explains how a font request has been resolved: the registry key used,
+// whether the registry already contained the font, every resolver attempted
+// and whether the fallback font has been substituted. Reports are available
+// from FontPromise.Report and Resolution.Report. Report.String formats a
+// report for humans, e.g. for support tickets.
+type Report struct {
+	Descriptor   fontfind.Descriptor   // the font request
+	Key          string                // normalized registry key for the request
+	RegistryHit  bool                  // font found in the registry
+	KnownMiss    bool                  // request failed before and the miss has been remembered (see NegativeCache)
+	Shared       bool                  // search has been shared with a concurrent request for the same key
+	Family       string                // requested family found, i.e. the winning entry of a font stack
+	Substitute   string                // family substituted for the requested one by an alias rule
+	Attempts     []Attempt             // resolvers attempted, in order
+	Font         fontfind.ScalableFont // font delivered
+	FallbackUsed bool                  // Font is the registry fallback font
+	Err          error                 // error delivered with the font
+	Duration     time.Duration         // total duration of the search
+}
+
+// Attempt records a call to a resolver.
+type Attempt struct {
+	Resolver   string                   // resolver name (see WithResolverNames)
+	Family     string                   // family searched for
+	Duration   time.Duration            // duration of the resolver call
+	Err        error                    // error returned by the resolver
+	Font       string                   // name of the font found, if any
+	Confidence fontfind.MatchConfidence // match confidence of the font found
+}
+
+// WithResolverNames returns a copy of a pipeline with names for its resolvers,
+// used in reports. Names are given in the order of resolvers. Resolvers
+// without a name are reported as "resolver #n", counting from 1.
+func (pipeline ResolverPipeline) WithResolverNames(names ...string) ResolverPipeline {
+	pipeline.names = append([]string(nil), names...)
+	pipeline.flights = &flightGroup{}
+	return pipeline
+}
+
+func (pipeline ResolverPipeline) resolverName(i int) string {
+	if i < len(pipeline.names) && pipeline.names[i] != "" {
+		return pipeline.names[i]
+	}
+	return fmt.Sprintf("resolver #%d", i+1)
+}
+
+// String formats a report, one line per step of the search.
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "font request %s (key %q)\n", r.Descriptor, r.Key)
+	switch {
+	case r.RegistryHit:
+		b.WriteString("  registry: hit\n")
+	case r.KnownMiss:
+		b.WriteString("  registry: known miss, resolvers skipped\n")
+	default:
+		b.WriteString("  registry: miss\n")
+	}
+	if r.Shared {
+		b.WriteString("  search shared with a concurrent request\n")
+	}
+	for _, a := range r.Attempts {
+		fmt.Fprintf(&b, "  %s for %q (%v): ", a.Resolver, a.Family, a.Duration.Round(time.Microsecond))
+		if a.Err != nil {
+			fmt.Fprintf(&b, "failed: %v\n", a.Err)
+		} else {
+			fmt.Fprintf(&b, "found %s, confidence %s\n", a.Font, confidenceName(a.Confidence))
+		}
+	}
+	fontName := r.Font.Name
+	if fontName == "" {
+		fontName = "no font"
+	}
+	if r.FallbackUsed {
+		fontName += " (fallback)"
+	} else {
+		if len(r.Descriptor.Families) > 0 && r.Family != "" {
+			fontName += fmt.Sprintf(" (font stack entry %q)", r.Family)
+		}
+		if r.Substitute != "" {
+			fontName += fmt.Sprintf(" (substitute family %q)", r.Substitute)
+		}
+	}
+	fmt.Fprintf(&b, "  result: %s in %v", fontName, r.Duration.Round(time.Microsecond))
+	if r.Err != nil {
+		fmt.Fprintf(&b, ", error: %v", r.Err)
+	}
+	return b.String()
+}
+
+func confidenceName(c fontfind.MatchConfidence) string {
+	switch c {
+	case fontfind.PerfectConfidence:
+		return "perfect"
+	case fontfind.HighConfidence:
+		return "high"
+	case fontfind.LowConfidence:
+		return "low"
+	case fontfind.NoConfidence:
+		return "none"
+	}
+	return fmt.Sprintf("%d", c)
+}
@@ -6,16 +6,21 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
 	"time"
 
 	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/fontregistry"
 	"github.com/npillmayer/fontfind/locate"
 	"github.com/npillmayer/fontfind/locate/fallbackfont"
 	"github.com/npillmayer/fontfind/locate/googlefont"
 	"github.com/npillmayer/fontfind/locate/systemfont"
+	"github.com/npillmayer/fontfind/observe"
 	"github.com/npillmayer/schuko/schukonf/testconfig"
 	"github.com/npillmayer/schuko/tracing/gotestingadapter"
 	"golang.org/x/image/font"
@@ -39,6 +44,69 @@ func TestLoadPackagedFont(t *testing.T) {
 	}
 }
 
+func TestFindPackagedFontByMetadata(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		pattern string
+		style   font.Style
+		weight  font.Weight
+		path    string
+	}{
+		{"Go", font.StyleItalic, font.WeightBold, "packaged/Go-Bold-Italic.otf"},
+		{"Go", font.StyleNormal, font.WeightNormal, "packaged/Go-Regular.otf"},
+		{"Go Mono", font.StyleNormal, font.WeightNormal, "packaged/Go-Mono.otf"},
+		{"Gentium", font.StyleNormal, font.WeightNormal, "packaged/GentiumPlus-R.ttf"},
+		{"monospace", font.StyleNormal, font.WeightNormal, "packaged/Go-Mono.otf"},
+		{"Sans-Serif", font.StyleItalic, font.WeightNormal, "packaged/Go-Italic.otf"},
+		{"serif", font.StyleNormal, font.WeightNormal, "packaged/GentiumPlus-R.ttf"},
+	} {
+		f, err := fallbackfont.FindFallbackFont(c.pattern, c.style, c.weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Path() != c.path {
+			t.Errorf("expected %s for %s, got %s", c.path, c.pattern, f.Path())
+		}
+	}
+}
+
+func TestFindPackagedFontForGenericFamily(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	_, err := fallbackfont.FindFallbackFont(fontfind.GenericEmoji, font.StyleNormal, font.WeightNormal)
+	if !errors.Is(err, fontfind.ErrNotFound) {
+		t.Errorf("expected no packaged emoji font, got %v", err)
+	}
+}
+
+func TestResolvedFontReportsActualMatch(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	f, err := fallbackfont.FindFallbackFont("Go", font.StyleItalic, font.WeightBold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Family != "Go" || f.Style != font.StyleItalic || f.Weight != font.WeightBold {
+		t.Errorf("expected Go bold italic, got %s style=%d weight=%d", f.Family, f.Style, f.Weight)
+	}
+	if f.Confidence != fontfind.PerfectConfidence || f.Source != fontfind.SourceEmbedded {
+		t.Errorf("expected perfect match from embedded source, got %d from %q", f.Confidence, f.Source)
+	}
+	// there is no black Go font, we expect the boldest Go font as a stand-in
+	f, err = fallbackfont.FindFallbackFont("Go", font.StyleNormal, font.WeightBlack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Weight != font.WeightBold || f.Confidence != fontfind.LowConfidence {
+		t.Errorf("expected stand-in font to report its weight, got weight=%d confidence=%d",
+			f.Weight, f.Confidence)
+	}
+}
+
 func TestResolveGoogleFont(t *testing.T) {
 	if os.Getenv("GOOGLE_FONTS_API_KEY") == "" {
 		t.Skip("requires GOOGLE_FONTS_API_KEY")
@@ -71,6 +139,7 @@ var fclist = `
 /System/Library/Fonts/NotoNastaliq.ttc: Noto Nastaliq Urdu:style=Bold
 /System/Library/Fonts/Supplemental/NotoSansCham-Regular.ttf: Noto Sans Cham:style=Regular
 /System/Library/Fonts/NotoSansArmenian.ttc: Noto Sans Armenian:style=Bold
+/System/Library/Fonts/Helvetica.ttc: Helvetica:style=Regular:index=1
 `
 
 func TestFCFind(t *testing.T) {
@@ -90,6 +159,30 @@ func TestFCFind(t *testing.T) {
 	if f.Path() != "NotoSansCham-Regular.ttf" {
 		t.Fatalf("expected path NotoSansCham-Regular.ttf, got %q", f.Path())
 	}
+	if f.Family != "Noto Sans Cham" || f.Source != fontfind.SourceSystem {
+		t.Errorf("expected Noto Sans Cham from system source, got %q from %q", f.Family, f.Source)
+	}
+}
+
+func TestFCFindCollection(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	desc := fontfind.Descriptor{
+		Pattern: "Helvetica",
+		Style:   font.StyleNormal,
+		Weight:  font.WeightNormal,
+	}
+	system := systemfont.Find("tyse-test", newIO())
+	f, err := locate.ResolveFontLoc(desc, system).Font()
+	if err != nil {
+		t.Fatalf("expected fixture-based systemfont hit, got error: %v", err)
+	}
+	if f.Path() != "Helvetica.ttc" || !f.IsCollection() {
+		t.Fatalf("expected font collection Helvetica.ttc, got %q", f.Path())
+	}
+	if f.CollectionIndex() != 1 {
+		t.Fatalf("expected collection index 1, got %d", f.CollectionIndex())
+	}
 }
 
 func TestResolveTypefaceUsesRegistryCache(t *testing.T) {
@@ -210,8 +303,14 @@ func TestResolveTypefaceReturnsFallbackOnMiss(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected lookup error for missing font")
 	}
-	if f.Name != "Go-Regular.otf" {
-		t.Fatalf("expected fallback Go-Regular.otf, got %q", f.Name)
+	if f.Name != "Go-Bold-Italic.otf" {
+		t.Fatalf("expected fallback Go-Bold-Italic.otf, got %q", f.Name)
+	}
+	// registries without styled fallback fonts deliver their fallback font
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry())
+	f, err = pipeline.Resolve(context.Background(), desc).Font()
+	if err == nil || f.Name != "Go-Regular.otf" {
+		t.Fatalf("expected fallback Go-Regular.otf and error, got %q, %v", f.Name, err)
 	}
 }
 
@@ -265,6 +364,726 @@ func TestResolveTypefaceContextDeadlineExceeded(t *testing.T) {
 	}
 }
 
+func TestFontPromiseMemoizesResult(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	desc := fontfind.Descriptor{Pattern: "Go", Style: font.StyleNormal, Weight: font.WeightNormal}
+	promise := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts).Resolve(context.Background(), desc)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f, err := promise.Font(); err != nil || f.Name != "Go-Regular.otf" {
+				t.Errorf("expected Go-Regular.otf, got %q, %v", f.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	<-promise.Done()
+	if f, ok, err := promise.Poll(); !ok || err != nil || f.Name != "Go-Regular.otf" {
+		t.Errorf("expected completed poll for Go-Regular.otf, got %q, %v, %v", f.Name, ok, err)
+	}
+	called := false
+	promise.OnComplete(func(f fontfind.ScalableFont, err error) {
+		called = f.Name == "Go-Regular.otf" && err == nil
+	})
+	if !called {
+		t.Errorf("expected callback on completed promise to be called immediately")
+	}
+}
+
+func TestFontPromiseCancel(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	started, stopped := make(chan struct{}), make(chan error, 1)
+	blocking := func(ctx context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return fontfind.NullFont, ctx.Err()
+	}
+	desc := fontfind.Descriptor{Pattern: "zz-cancelled-promise"}
+	promise := locate.NewResolverPipeline(newMemoryRegistry(), blocking).Resolve(context.Background(), desc)
+	callback := make(chan error, 1)
+	promise.OnComplete(func(_ fontfind.ScalableFont, err error) {
+		callback <- err
+	})
+	<-started
+	if _, ok, _ := promise.Poll(); ok {
+		t.Fatalf("expected pending promise")
+	}
+	promise.Cancel()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected resolver context to be cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("resolver has not been cancelled")
+	}
+	if err := <-callback; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected callback with context.Canceled, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if f, err := promise.Font(); !errors.Is(err, context.Canceled) || f != fontfind.NullFont {
+			t.Errorf("expected null font and context.Canceled, got %q, %v", f.Name, err)
+		}
+	}
+}
+
+func TestResolverPipelineCoalescesConcurrentSearches(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	var calls atomic.Int32
+	release := make(chan struct{})
+	resolver := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		calls.Add(1)
+		<-release
+		return fontfind.ScalableFont{Name: "probe-flight.ttf"}, nil
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), resolver)
+	desc := fontfind.Descriptor{Pattern: "zz-flight-probe", Style: font.StyleNormal, Weight: font.WeightNormal}
+	promises := make([]locate.FontPromise, 50)
+	for i := range promises {
+		promises[i] = pipeline.Resolve(context.Background(), desc)
+	}
+	time.Sleep(10 * time.Millisecond) // let searches join the flight
+	close(release)
+	for _, promise := range promises {
+		if f, err := promise.Font(); err != nil || f.Name != "probe-flight.ttf" {
+			t.Fatalf("expected probe-flight.ttf, got %q, %v", f.Name, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected resolver to be called once, got %d", n)
+	}
+}
+
+func TestResolverPipelineSharedSearchSurvivesSingleCancel(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	resolver := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return fontfind.NullFont, ctx.Err()
+		case <-release:
+			return fontfind.ScalableFont{Name: "probe-shared.ttf"}, nil
+		}
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), resolver)
+	desc := fontfind.Descriptor{Pattern: "zz-shared-probe", Style: font.StyleNormal, Weight: font.WeightNormal}
+	ctxA, cancelA := context.WithCancel(context.Background())
+	a := pipeline.Resolve(ctxA, desc)
+	<-started
+	b := pipeline.Resolve(context.Background(), desc)
+	time.Sleep(10 * time.Millisecond) // let b join the flight
+	cancelA()
+	if _, err := a.Font(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled caller to get context.Canceled, got %v", err)
+	}
+	close(release)
+	if f, err := b.Font(); err != nil || f.Name != "probe-shared.ttf" {
+		t.Errorf("expected remaining caller to get probe-shared.ttf, got %q, %v", f.Name, err)
+	}
+	if len(started) != 0 {
+		t.Errorf("expected a single search")
+	}
+}
+
+func TestResolverPipelineCancelsSearchWithoutWaiters(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	started, stopped := make(chan struct{}), make(chan error, 1)
+	resolver := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return fontfind.NullFont, ctx.Err()
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), resolver)
+	desc := fontfind.Descriptor{Pattern: "zz-abandoned-probe", Style: font.StyleNormal, Weight: font.WeightNormal}
+	a := pipeline.Resolve(context.Background(), desc)
+	<-started
+	b := pipeline.Resolve(context.Background(), desc)
+	time.Sleep(10 * time.Millisecond) // let b join the flight
+	a.Cancel()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-stopped:
+		t.Fatalf("search has been cancelled while b is still waiting")
+	default:
+	}
+	b.Cancel()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected search to be cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("search has not been cancelled after all callers gave up")
+	}
+}
+
+func TestResolverPipelinesDoNotShareSearches(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	started, release := make(chan struct{}), make(chan struct{})
+	failing := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		close(started)
+		<-release
+		return fontfind.NullFont, errors.New("not found")
+	}
+	working := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.ScalableFont{Name: "probe-pipelines.ttf"}, nil
+	}
+	// both pipelines work on the global registry
+	p1 := locate.NewResolverPipeline(nil, failing)
+	p2 := locate.NewResolverPipeline(nil, working)
+	desc := fontfind.Descriptor{Pattern: "zz-pipelines-probe-" + time.Now().Format(time.RFC3339Nano),
+		Style: font.StyleNormal, Weight: font.WeightNormal}
+	a := p1.Resolve(context.Background(), desc)
+	<-started
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if f, err := p2.Resolve(ctx, desc).Font(); err != nil || f.Name != "probe-pipelines.ttf" {
+		t.Errorf("expected second pipeline to find probe-pipelines.ttf, got %q, %v", f.Name, err)
+	}
+	a.Cancel()
+}
+
+func TestResolveAll(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	var calls, running, maxRunning atomic.Int32
+	resolver := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		calls.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		if desc.Pattern == "zz-batch-missing" {
+			return fontfind.NullFont, errors.New("no such font")
+		}
+		return fontfind.ScalableFont{Name: desc.Pattern + ".ttf"}, nil
+	}
+	var descs []fontfind.Descriptor
+	for _, pattern := range []string{"a", "b", "c", "a", "zz-batch-missing", "d", "e", "b"} {
+		descs = append(descs, fontfind.Descriptor{Pattern: pattern, Style: font.StyleNormal, Weight: font.WeightNormal})
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), resolver).WithConcurrency(2)
+	resolutions, err := pipeline.ResolveAll(context.Background(), descs)
+	if err == nil {
+		t.Errorf("expected error for missing font")
+	}
+	if len(resolutions) != len(descs) {
+		t.Fatalf("expected %d resolutions, got %d", len(descs), len(resolutions))
+	}
+	for i, r := range resolutions {
+		if r.Descriptor.Pattern != descs[i].Pattern {
+			t.Errorf("resolution #%d is for %q, expected %q", i, r.Descriptor.Pattern, descs[i].Pattern)
+		}
+		if r.Descriptor.Pattern == "zz-batch-missing" {
+			if r.Err == nil || r.Font.Name != "Go-Regular.otf" {
+				t.Errorf("expected fallback font and error for missing font, got %q, %v", r.Font.Name, r.Err)
+			}
+		} else if r.Err != nil || r.Font.Name != r.Descriptor.Pattern+".ttf" {
+			t.Errorf("expected %s.ttf, got %q, %v", r.Descriptor.Pattern, r.Font.Name, r.Err)
+		}
+	}
+	if n := calls.Load(); n != 6 {
+		t.Errorf("expected 6 resolver calls for 6 distinct descriptors, got %d", n)
+	}
+	if n := maxRunning.Load(); n > 2 {
+		t.Errorf("expected at most 2 concurrent searches, got %d", n)
+	}
+}
+
+func TestResolveAllDeadline(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	resolver := func(ctx context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		if desc.Pattern == "fast" {
+			return fontfind.ScalableFont{Name: "fast.ttf"}, nil
+		}
+		<-ctx.Done()
+		return fontfind.NullFont, ctx.Err()
+	}
+	descs := []fontfind.Descriptor{{Pattern: "fast"}, {Pattern: "slow"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resolutions, err := locate.NewResolverPipeline(newMemoryRegistry(), resolver).ResolveAll(ctx, descs)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if resolutions[0].Err != nil || resolutions[0].Font.Name != "fast.ttf" {
+		t.Errorf("expected fast.ttf, got %q, %v", resolutions[0].Font.Name, resolutions[0].Err)
+	}
+	if !errors.Is(resolutions[1].Err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded for slow font, got %v", resolutions[1].Err)
+	}
+}
+
+func TestResolverPipelineRemembersMisses(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	calls := 0
+	resolver := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		calls++
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: d.Pattern, Source: "probe"}
+	}
+	desc := fontfind.Descriptor{Pattern: "zz-negative-probe", Style: font.StyleNormal, Weight: font.WeightNormal}
+	reg := fontregistry.New()
+	pipeline := locate.NewResolverPipeline(reg, resolver)
+	for i := 0; i < 3; i++ {
+		f, err := pipeline.Resolve(context.Background(), desc).Font()
+		if err == nil || f.Name != "Go-Regular.otf" {
+			t.Fatalf("expected fallback font and error, got %q, %v", f.Name, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected resolver to be called once, got %d", calls)
+	}
+	reg.InvalidateMiss(fontregistry.NormalizeDescriptor(desc))
+	pipeline.Resolve(context.Background(), desc).Font()
+	if calls != 2 {
+		t.Errorf("expected resolver to be called after invalidation, got %d calls", calls)
+	}
+	// misses are not remembered with a negative TTL
+	noCache := locate.NewResolverPipeline(fontregistry.New(), resolver).WithMissTTL(-1)
+	noCache.Resolve(context.Background(), desc).Font()
+	noCache.Resolve(context.Background(), desc).Font()
+	if calls != 4 {
+		t.Errorf("expected resolver to be called for every request, got %d calls", calls)
+	}
+}
+
+func TestResolverPipelineForgetsTransientFailures(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	calls := 0
+	notFound := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: d.Pattern, Source: "system"}
+	}
+	offline := func(_ context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		calls++
+		return fontfind.NullFont, &fontfind.SourceError{Source: "google", Err: errors.New("network down")}
+	}
+	unknown := func(_ context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		calls++
+		return fontfind.NullFont, errors.New("cannot read font directory")
+	}
+	desc := fontfind.Descriptor{Pattern: "zz-transient-probe"}
+	for _, resolver := range []locate.FontLocatorWithContext{offline, unknown} {
+		calls = 0
+		reg := fontregistry.New()
+		pipeline := locate.NewResolverPipeline(reg, notFound, resolver)
+		for i := 0; i < 2; i++ {
+			if _, err := pipeline.Resolve(context.Background(), desc).Font(); err == nil {
+				t.Fatalf("expected error for unresolvable font")
+			}
+		}
+		if calls != 2 || reg.Miss(fontregistry.NormalizeDescriptor(desc)) != nil {
+			t.Errorf("expected transient failure not to be remembered, resolver called %d times", calls)
+		}
+	}
+	// a pipeline without resolvers has not searched the font at all
+	reg := fontregistry.New()
+	if _, err := locate.NewResolverPipeline(reg).Resolve(context.Background(), desc).Font(); err == nil {
+		t.Fatalf("expected error for unresolvable font")
+	}
+	if reg.Miss(fontregistry.NormalizeDescriptor(desc)) != nil {
+		t.Errorf("expected miss of a pipeline without resolvers not to be remembered")
+	}
+}
+
+func TestResolutionReport(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	failing := func(_ context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, errors.New("not installed")
+	}
+	found := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		if d.Pattern != "zz-report-probe" {
+			return fontfind.NullFont, errors.New("unknown family")
+		}
+		return fontfind.ScalableFont{Name: "probe-report.ttf", Confidence: fontfind.HighConfidence}, nil
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), failing, found).WithResolverNames("system")
+	desc := fontfind.Descriptor{Pattern: "zz-report-probe", Style: font.StyleNormal, Weight: font.WeightBold}
+	promise := pipeline.Resolve(context.Background(), desc)
+	promise.Font()
+	report := promise.Report()
+	if report == nil {
+		t.Fatalf("expected report for completed promise")
+	}
+	if report.Key != "zz-report-probe-bold" || report.RegistryHit || report.FallbackUsed {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Attempts) != 2 || report.Attempts[0].Resolver != "system" || report.Attempts[0].Err == nil ||
+		report.Attempts[1].Resolver != "resolver #2" || report.Attempts[1].Confidence != fontfind.HighConfidence {
+		t.Errorf("unexpected attempts %+v", report.Attempts)
+	}
+	text := report.String()
+	for _, s := range []string{"system", "not installed", "probe-report.ttf", "confidence high"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected printed report to contain %q, got\n%s", s, text)
+		}
+	}
+	t.Logf("report:\n%s", text)
+	//
+	promise = pipeline.Resolve(context.Background(), desc)
+	promise.Font()
+	if report = promise.Report(); !report.RegistryHit || len(report.Attempts) != 0 {
+		t.Errorf("expected registry hit without attempts, got %+v", report)
+	}
+	promise = pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "zz-report-missing"})
+	promise.Font()
+	if report = promise.Report(); !report.FallbackUsed || report.Err == nil || report.Font.Name != "Go-Regular.otf" {
+		t.Errorf("expected report of fallback substitution, got %+v", report)
+	}
+}
+
+func TestResolutionErrors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	offline := func(_ context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, &fontfind.SourceError{Source: "google", Err: errors.New("network down")}
+	}
+	missing := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: d.Pattern, Source: "system"}
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), missing, offline).WithResolverNames("system", "google")
+	_, err := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "zz-error-probe"}).Font()
+	for _, target := range []error{fontfind.ErrNotFound, fontfind.ErrFallbackSubstituted, fontfind.ErrSourceUnavailable} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected error to match %q, got %v", target, err)
+		}
+	}
+	var resErr *fontfind.ResolutionError
+	if !errors.As(err, &resErr) || len(resErr.Failures) != 2 {
+		t.Fatalf("expected resolution error with 2 failures, got %v", err)
+	}
+	var resolverErr *fontfind.ResolverError
+	if !errors.As(resErr.Failures[1], &resolverErr) || resolverErr.Resolver != "google" {
+		t.Errorf("expected failure of resolver google, got %v", resErr.Failures[1])
+	}
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pipeline.Resolve(ctx, fontfind.Descriptor{Pattern: "zz-error-probe"}).Font()
+	if !errors.Is(err, fontfind.ErrCancelled) || !errors.Is(err, context.Canceled) || errors.Is(err, fontfind.ErrNotFound) {
+		t.Errorf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestResolverPipelineObserver(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	failing := func(_ context.Context, _ fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		return fontfind.NullFont, errors.New("not installed")
+	}
+	var observed bool
+	found := func(ctx context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		observed = observe.FromContext(ctx) != nil
+		if d.Pattern != "zz-observed-probe" {
+			return fontfind.NullFont, errors.New("unknown family")
+		}
+		return fontfind.ScalableFont{Name: "probe-observed.ttf"}, nil
+	}
+	stats, registryStats := observe.NewStats(), observe.NewStats()
+	reg := fontregistry.New()
+	reg.SetObserver(registryStats)
+	pipeline := locate.NewResolverPipeline(reg, failing, found).
+		WithResolverNames("system", "google").WithObserver(stats)
+	desc := fontfind.Descriptor{Pattern: "zz-observed-probe"}
+	for i := 0; i < 3; i++ {
+		pipeline.Resolve(context.Background(), desc).Font()
+	}
+	pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "zz-observed-missing"}).Font()
+	snap := stats.Snapshot()
+	if snap.Counts[observe.CacheHit] != 2 || snap.Counts[observe.CacheMiss] != 2 || snap.Counts[observe.FallbackUsed] != 1 {
+		t.Errorf("unexpected counts %v", snap.Counts)
+	}
+	if rs := snap.Resolvers["system"]; rs.Calls != 2 || rs.Failures != 2 {
+		t.Errorf("unexpected stats for resolver system: %+v", rs)
+	}
+	if rs := snap.Resolvers["google"]; rs.Calls != 2 || rs.Failures != 1 {
+		t.Errorf("unexpected stats for resolver google: %+v", rs)
+	}
+	if !observed {
+		t.Errorf("expected observer to be handed to resolvers")
+	}
+	if n := registryStats.Count(observe.RegistryStore); n != 1 {
+		t.Errorf("expected registry to observe 1 store, got %d", n)
+	}
+}
+
+func TestResolverPipelineSubstitutesAliases(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	var searched []string
+	resolver := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		searched = append(searched, d.Pattern)
+		switch d.Pattern {
+		case "Liberation Sans", "Inter":
+			return fontfind.ScalableFont{Name: d.Pattern + ".ttf", Family: d.Pattern}, nil
+		}
+		return fontfind.NullFont, errors.New("not installed")
+	}
+	reg := newMemoryRegistry()
+	pipeline := locate.NewResolverPipeline(reg, resolver)
+	promise := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "Arial"})
+	if f, err := promise.Font(); err != nil || f.Name != "Liberation Sans.ttf" {
+		t.Errorf("expected Arial to be substituted by Liberation Sans, got %q, %v", f.Name, err)
+	}
+	if !reflect.DeepEqual(searched, []string{"Arial", "Liberation Sans"}) {
+		t.Errorf("expected Arial to be searched before its substitute, searched %v", searched)
+	}
+	if r := promise.Report(); r.Substitute != "Liberation Sans" {
+		t.Errorf("expected report to name substitute family, got %q", r.Substitute)
+	}
+	if f, err := reg.GetFont("liberation_sans"); err != nil || f.Name != "Liberation Sans.ttf" {
+		t.Errorf("expected substitute to be cached under its own key, got %q, %v", f.Name, err)
+	}
+	//
+	searched = nil
+	aliases := fontfind.NewAliasTable(fontfind.Alias{Family: "Helvetica", Prefer: []string{"Inter"}})
+	pipeline = locate.NewResolverPipeline(newMemoryRegistry(), resolver).WithAliases(aliases)
+	if f, _ := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "Helvetica"}).Font(); f.Name != "Inter.ttf" {
+		t.Errorf("expected preferred family Inter for Helvetica, got %q", f.Name)
+	}
+	if !reflect.DeepEqual(searched, []string{"Inter"}) {
+		t.Errorf("expected preferred family to be searched first, searched %v", searched)
+	}
+	// no substitution with an empty table
+	pipeline = locate.NewResolverPipeline(newMemoryRegistry(), resolver).WithAliases(fontfind.NewAliasTable())
+	if _, err := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "Arial"}).Font(); err == nil {
+		t.Errorf("expected Arial not to be substituted without alias rules")
+	}
+}
+
+func TestResolverPipelineResolvesGenericFamilies(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts)
+	for generic, expected := range map[string]string{
+		fontfind.GenericMonospace: "Go-Mono.otf",
+		fontfind.GenericSansSerif: "Go-Regular.otf",
+		fontfind.GenericSerif:     "GentiumPlus-R.ttf",
+	} {
+		promise := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: generic})
+		if f, err := promise.Font(); err != nil || f.Name != expected {
+			t.Errorf("expected %s for generic family %s, got %q, %v", expected, generic, f.Name, err)
+		}
+		if r := promise.Report(); r.Substitute != "" || r.FallbackUsed {
+			t.Errorf("expected %s to be resolved by its category, got report\n%s", generic, r.String())
+		}
+	}
+}
+
+func TestResolverPipelineSubstitutesAliasesOfPackagedFonts(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	aliases := fontfind.NewAliasTable(fontfind.Alias{Family: "Arial", Accept: []string{"Liberation Sans", "Go"}})
+	reg := newMemoryRegistry()
+	pipeline := locate.NewResolverPipeline(reg, packagedFonts).WithAliases(aliases)
+	promise := pipeline.Resolve(context.Background(), fontfind.Descriptor{Pattern: "Arial", Weight: font.WeightBold})
+	if f, err := promise.Font(); err != nil || f.Name != "Go-Bold.otf" {
+		t.Fatalf("expected Arial to be substituted by Go Bold, got %q, %v", f.Name, err)
+	}
+	if r := promise.Report(); r.Substitute != "Go" || len(r.Attempts) != 3 {
+		t.Errorf("expected unknown families not to be found, got report\n%s", r.String())
+	}
+	if _, err := reg.GetFont("liberation_sans-bold"); err == nil {
+		t.Errorf("expected unknown family not to be cached")
+	}
+	if f, err := reg.GetFont("arial-bold"); err != nil || f.Name != "Go-Bold.otf" {
+		t.Errorf("expected substitute to be cached under the requested key, got %q, %v", f.Name, err)
+	}
+}
+
+func TestResolverPipelineResolvesFontStackOfPackagedFonts(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts)
+	promise := pipeline.Resolve(context.Background(), fontfind.FontStack("Nonexistent Family", "Go Mono"))
+	if f, err := promise.Font(); err != nil || f.Name != "Go-Mono.otf" {
+		t.Fatalf("expected second entry of stack Go Mono, got %q, %v", f.Name, err)
+	}
+	if r := promise.Report(); r.Family != "Go Mono" || len(r.Attempts) != 2 {
+		t.Errorf("expected first entry of stack to miss, got report\n%s", r.String())
+	}
+}
+
+func TestResolverPipelineResolvesFontStack(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	var searched []string
+	installed := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		searched = append(searched, "installed:"+d.Pattern)
+		if d.Pattern == "Noto Serif" {
+			return fontfind.ScalableFont{Name: "NotoSerif.ttf", Family: d.Pattern}, nil
+		}
+		return fontfind.NullFont, errors.New("not installed")
+	}
+	web := func(_ context.Context, d fontfind.Descriptor) (fontfind.ScalableFont, error) {
+		searched = append(searched, "web:"+d.Pattern)
+		if d.Pattern == "Georgia" {
+			return fontfind.ScalableFont{Name: "Georgia.ttf", Family: d.Pattern}, nil
+		}
+		return fontfind.NullFont, errors.New("not available")
+	}
+	reg := newMemoryRegistry()
+	pipeline := locate.NewResolverPipeline(reg, installed, web).
+		WithResolverNames("installed", "web").
+		WithAliases(fontfind.NewAliasTable())
+	desc := fontfind.FontStack("Source Serif 4", "Noto Serif", "Georgia", "serif")
+	promise := pipeline.Resolve(context.Background(), desc)
+	if f, err := promise.Font(); err != nil || f.Name != "NotoSerif.ttf" {
+		t.Fatalf("expected first available family of stack, got %q, %v", f.Name, err)
+	}
+	expected := []string{"installed:Source Serif 4", "web:Source Serif 4", "installed:Noto Serif"}
+	if !reflect.DeepEqual(searched, expected) {
+		t.Errorf("expected families to be searched with all resolvers in order, searched %v", searched)
+	}
+	r := promise.Report()
+	if r.Key != "source_serif_4,noto_serif,georgia,serif" || r.Family != "Noto Serif" || r.FallbackUsed {
+		t.Errorf("expected report to name winning stack entry, got key %q, family %q", r.Key, r.Family)
+	}
+	if !strings.Contains(r.String(), `font stack entry "Noto Serif"`) {
+		t.Errorf("expected report text to name winning stack entry, got\n%s", r.String())
+	}
+	if f, err := reg.GetFont("noto_serif"); err != nil || f.Name != "NotoSerif.ttf" {
+		t.Errorf("expected font to be cached under its family key, got %q, %v", f.Name, err)
+	}
+	// a stack with a cached entry is satisfied from the registry
+	searched = nil
+	desc = fontfind.FontStack("Source Serif 4", "Noto Serif")
+	if f, _ := pipeline.Resolve(context.Background(), desc).Font(); f.Name != "NotoSerif.ttf" {
+		t.Errorf("expected cached stack entry, got %q", f.Name)
+	}
+	if !reflect.DeepEqual(searched, []string{"installed:Source Serif 4", "web:Source Serif 4"}) {
+		t.Errorf("expected resolvers to be skipped for cached entry, searched %v", searched)
+	}
+	// no family of the stack available
+	promise = pipeline.Resolve(context.Background(), fontfind.FontStack("Source Serif 4", "serif"))
+	if _, err := promise.Font(); !errors.Is(err, fontfind.ErrFallbackSubstituted) || !promise.Report().FallbackUsed {
+		t.Errorf("expected fallback for unavailable stack, got %v", err)
+	}
+}
+
+func TestResolveTextByCoverage(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	primary := fontfind.Descriptor{Pattern: "Go", Style: font.StyleNormal, Weight: font.WeightNormal}
+	fallbacks := []fontfind.Descriptor{
+		{Pattern: "Gentium", Style: font.StyleNormal, Weight: font.WeightNormal},
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts)
+	text := "Go ἀρχή नमस्ते 😀"
+	runs, err := pipeline.ResolveText(context.Background(), primary, fallbacks, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		text, script, font string
+		covered            bool
+	}{
+		{"Go ", "Latin", "Go-Regular.otf", true},
+		{"ἀρχή ", "Greek", "GentiumPlus-R.ttf", true},
+		{"नमस्ते 😀", "Devanagari", "Go-Regular.otf", false},
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, got %d: %+v", len(expected), len(runs), runs)
+	}
+	for i, run := range runs {
+		exp := expected[i]
+		if run.Text != exp.text || run.Script != exp.script || run.Font.Name != exp.font || run.Covered != exp.covered {
+			t.Errorf("run #%d: expected %q/%s/%s/%v, got %q/%s/%s/%v", i, exp.text, exp.script, exp.font,
+				exp.covered, run.Text, run.Script, run.Font.Name, run.Covered)
+		}
+		if text[run.Start:run.End] != run.Text {
+			t.Errorf("run #%d: offsets %d…%d do not match text %q", i, run.Start, run.End, run.Text)
+		}
+	}
+}
+
+func TestResolveTextSplitsPartiallyCoveredRun(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	primary := fontfind.Descriptor{Pattern: "Go", Style: font.StyleNormal, Weight: font.WeightNormal}
+	fallbacks := []fontfind.Descriptor{
+		{Pattern: "Gentium", Style: font.StyleNormal, Weight: font.WeightNormal},
+	}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts)
+	runs, err := pipeline.ResolveText(context.Background(), primary, fallbacks, "fish ʃɪʃ and ☃")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fonts []string
+	for _, run := range runs {
+		fonts = append(fonts, run.Font.Name+":"+run.Text)
+	}
+	// runs stick to the font of the previous rune, as long as it covers them
+	if len(runs) != 3 || runs[0].Text != "fish " || runs[1].Font.Name != "GentiumPlus-R.ttf" ||
+		runs[1].Text != "ʃɪʃ and " || runs[2].Covered {
+		t.Errorf("unexpected runs %v", fonts)
+	}
+}
+
+func TestResolveTextOfInvalidUTF8(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	primary := fontfind.Descriptor{Pattern: "Go", Style: font.StyleNormal, Weight: font.WeightNormal}
+	pipeline := locate.NewResolverPipeline(newMemoryRegistry(), packagedFonts)
+	text := "abc\xff"
+	runs, err := pipeline.ResolveText(context.Background(), primary, nil, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joined string
+	for _, run := range runs {
+		if text[run.Start:run.End] != run.Text {
+			t.Errorf("offsets %d…%d do not match text %q", run.Start, run.End, run.Text)
+		}
+		joined += run.Text
+	}
+	if joined != text {
+		t.Errorf("expected runs to cover %q, got %q", text, joined)
+	}
+}
+
+// packagedFonts resolves fonts from the packaged fallback fonts.
+func packagedFonts(_ context.Context, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+	return fallbackfont.Find()(desc)
+}
+
 type memoryRegistry struct {
 	mu    sync.Mutex
 	fonts map[string]fontfind.ScalableFont
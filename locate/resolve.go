@@ -2,29 +2,41 @@ package locate
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/npillmayer/fontfind"
 	"github.com/npillmayer/fontfind/fontregistry"
+	"github.com/npillmayer/fontfind/observe"
 )
 
-// notFound returns an application error for a missing resource.
-func notFound(res string) error {
-	return fmt.Errorf("font not found: %v", res)
-}
-
 // fontPlusErr is a helper struct to exchange through channels.
 type fontPlusErr struct {
-	font fontfind.ScalableFont
-	err  error
+	font   fontfind.ScalableFont
+	err    error
+	report *Report // nil if no search has been run
 }
 
 // FontPromise runs font searching asynchronously in the background.
 // Font blocks until completion, and FontWithContext allows waiting with
 // caller-controlled cancellation and deadlines.
+//
+// The result of the search is memoized, i.e. a promise may be awaited any
+// number of times, from any number of goroutines, and always delivers the same
+// font and error. Done, Poll and OnComplete allow clients to react to
+// completion without blocking. Report explains how the font has been
+// resolved. Cancel abandons a promise: the search is
+// cancelled and the promise completes with context.Canceled, unless it has
+// completed before.
 type FontPromise interface {
 	Font() (fontfind.ScalableFont, error)
 	FontWithContext(ctx context.Context) (fontfind.ScalableFont, error)
+	Done() <-chan struct{}
+	Poll() (fontfind.ScalableFont, bool, error)
+	OnComplete(func(fontfind.ScalableFont, error))
+	Cancel()
+	Report() *Report
 }
 
 // FontRegistry is the cache contract required by ResolverPipeline.
@@ -34,10 +46,62 @@ type FontRegistry interface {
 	FallbackFont() (fontfind.ScalableFont, error)
 }
 
+// NegativeCache is an optional extension of FontRegistry. Registries
+// implementing it remember failed lookups: if all the resolvers report a font
+// as not found (fontfind.ErrNotFound), the pipeline stores a miss, and until
+// the miss expires or is invalidated, requests for the font return the
+// fallback font without running the resolvers again. Other failures, e.g. of unavailable font sources, are
+// not remembered. fontregistry.Registry implements NegativeCache.
+type NegativeCache interface {
+	StoreMiss(normalizedName string, reason error, ttl time.Duration)
+	Miss(normalizedName string) error // nil if no (unexpired) miss is stored
+	InvalidateMiss(normalizedName string)
+}
+
+// StyledFallback is an optional extension of FontRegistry. Registries
+// implementing it deliver fallback fonts matching the style, weight and width
+// of a request, e.g. a bold italic fallback font for a bold italic request
+// which cannot be resolved. For other registries, the pipeline uses
+// FallbackFont. fontregistry.Registry implements StyledFallback.
+type StyledFallback interface {
+	FallbackFontFor(fontfind.Descriptor) (fontfind.ScalableFont, error)
+}
+
+var (
+	_ FontRegistry   = (*fontregistry.Registry)(nil)
+	_ NegativeCache  = (*fontregistry.Registry)(nil)
+	_ StyledFallback = (*fontregistry.Registry)(nil)
+)
+
+// fallbackFont returns the registry's fallback font for a request.
+func fallbackFont(registry FontRegistry, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
+	if sf, ok := registry.(StyledFallback); ok {
+		return sf.FallbackFontFor(desc)
+	}
+	return registry.FallbackFont()
+}
+
+// DefaultMissTTL is the time failed lookups are remembered by registries
+// implementing NegativeCache, if not configured otherwise with WithMissTTL.
+const DefaultMissTTL = 5 * time.Minute
+
 // ResolverPipeline orchestrates resolver execution with a configurable registry.
+//
+// Concurrent requests for the same font (i.e., for descriptors with the same
+// normalized name) are coalesced: the resolvers run once and all the callers
+// share the result. Copies of a pipeline share their in-flight searches, but
+// pipelines never join searches of other pipelines, even if they work on the
+// same registry. Copies made with options other than WithConcurrency are new
+// pipelines in this respect.
 type ResolverPipeline struct {
-	registry  FontRegistry
-	resolvers []FontLocatorWithContext
+	registry    FontRegistry
+	resolvers   []FontLocatorWithContext
+	flights     *flightGroup
+	concurrency int           // limit for ResolveAll
+	missTTL     time.Duration // lifetime of failed lookups in a NegativeCache
+	names       []string      // resolver names for reports
+	observer    observe.Observer
+	aliases     *fontfind.AliasTable // nil for the built-in rules
 }
 
 // NewResolverPipeline constructs a resolver driver with an optional custom registry.
@@ -51,19 +115,171 @@ func NewResolverPipeline(reg FontRegistry, resolvers ...FontLocatorWithContext)
 	return ResolverPipeline{
 		registry:  reg,
 		resolvers: rs,
+		flights:   &flightGroup{},
+	}
+}
+
+// WithMissTTL returns a copy of a pipeline which remembers failed lookups for
+// duration ttl, if its registry implements NegativeCache. If ttl is negative,
+// failed lookups are not remembered. If ttl is 0, DefaultMissTTL is used.
+func (pipeline ResolverPipeline) WithMissTTL(ttl time.Duration) ResolverPipeline {
+	pipeline.missTTL = ttl
+	pipeline.flights = &flightGroup{}
+	return pipeline
+}
+
+// WithObserver returns a copy of a pipeline reporting events to obs (see
+// package observe). The observer is handed to resolvers through their context
+// as well, see observe.FromContext.
+func (pipeline ResolverPipeline) WithObserver(obs observe.Observer) ResolverPipeline {
+	pipeline.observer = obs
+	pipeline.flights = &flightGroup{}
+	return pipeline
+}
+
+// WithAliases returns a copy of a pipeline using a table of family
+// substitution rules. Without a table, pipelines use the built-in rules of
+// fontfind.DefaultAliases. Pass an empty table to disable substitution.
+func (pipeline ResolverPipeline) WithAliases(aliases *fontfind.AliasTable) ResolverPipeline {
+	pipeline.aliases = aliases
+	pipeline.flights = &flightGroup{}
+	return pipeline
+}
+
+var defaultAliases = fontfind.DefaultAliases()
+
+func (pipeline ResolverPipeline) aliasTable() *fontfind.AliasTable {
+	if pipeline.aliases == nil {
+		return defaultAliases
+	}
+	return pipeline.aliases
+}
+
+func (pipeline ResolverPipeline) missTTLOrDefault() time.Duration {
+	if pipeline.missTTL == 0 {
+		return DefaultMissTTL
+	}
+	return pipeline.missTTL
+}
+
+// search searches a font, joining a search already in flight for the same font.
+func (pipeline ResolverPipeline) search(ctx context.Context, registry FontRegistry, desc fontfind.Descriptor) fontPlusErr {
+	if pipeline.flights == nil { // zero pipeline
+		return pipeline.searchScalableFont(ctx, registry, desc)
+	}
+	return pipeline.flights.search(ctx, fontregistry.NormalizeDescriptor(desc), func(flightCtx context.Context) fontPlusErr {
+		return pipeline.searchScalableFont(flightCtx, registry, desc)
+	})
+}
+
+// fontPromise is the implementation of FontPromise. It completes exactly once,
+// either with the result of the search or by cancellation.
+type fontPromise struct {
+	done      chan struct{}
+	cancel    context.CancelFunc // cancels the search
+	mu        sync.Mutex         // guards result and callbacks
+	result    fontPlusErr
+	callbacks []func(fontfind.ScalableFont, error)
+}
+
+func newFontPromise(cancel context.CancelFunc) *fontPromise {
+	return &fontPromise{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+}
+
+// complete sets the result of a promise, if it is not already completed, and
+// calls the completion callbacks.
+func (p *fontPromise) complete(result fontPlusErr) {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		return
+	default:
+	}
+	p.result = result
+	close(p.done)
+	callbacks := p.callbacks
+	p.callbacks = nil
+	p.mu.Unlock()
+	for _, callback := range callbacks {
+		callback(result.font, result.err)
+	}
+}
+
+// Font blocks until the font search completes.
+func (p *fontPromise) Font() (fontfind.ScalableFont, error) {
+	return p.FontWithContext(context.Background())
+}
+
+// FontWithContext blocks until the font search completes or ctx is done.
+// Giving up waiting does not cancel the search, see Cancel.
+func (p *fontPromise) FontWithContext(ctx context.Context) (fontfind.ScalableFont, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-p.done:
+		return p.result.font, p.result.err
+	case <-ctx.Done():
+		return fontfind.NullFont, fontfind.Cancelled(ctx.Err())
 	}
 }
 
-type fontLoader struct {
-	await func(ctx context.Context) (fontfind.ScalableFont, error)
+// Done returns a channel which is closed when the promise completes.
+func (p *fontPromise) Done() <-chan struct{} {
+	return p.done
+}
+
+// Poll returns the result of a promise without blocking. The boolean result
+// is false if the promise has not yet completed.
+func (p *fontPromise) Poll() (fontfind.ScalableFont, bool, error) {
+	select {
+	case <-p.done:
+		return p.result.font, true, p.result.err
+	default:
+		return fontfind.NullFont, false, nil
+	}
+}
+
+// OnComplete registers a callback to be called with the result of the
+// promise. Callbacks are called in the order of registration by the goroutine
+// completing the promise. If the promise has already completed, callback is
+// called immediately.
+func (p *fontPromise) OnComplete(callback func(fontfind.ScalableFont, error)) {
+	if callback == nil {
+		return
+	}
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		callback(p.result.font, p.result.err)
+		return
+	default:
+	}
+	p.callbacks = append(p.callbacks, callback)
+	p.mu.Unlock()
 }
 
-func (loader fontLoader) Font() (fontfind.ScalableFont, error) {
-	return loader.FontWithContext(context.Background())
+// Report returns the report of the font search. It is nil if the promise has
+// not yet completed, or if it has been cancelled before the search started.
+func (p *fontPromise) Report() *Report {
+	select {
+	case <-p.done:
+		return p.result.report
+	default:
+		return nil
+	}
 }
 
-func (loader fontLoader) FontWithContext(ctx context.Context) (fontfind.ScalableFont, error) {
-	return loader.await(ctx)
+// Cancel abandons a promise. If it has not yet completed, it completes with
+// context.Canceled (and fontfind.ErrCancelled), and the context handed to the resolvers is cancelled.
+func (p *fontPromise) Cancel() {
+	p.complete(fontPlusErr{font: fontfind.NullFont, err: fontfind.Cancelled(context.Canceled)})
+	p.cancel()
 }
 
 // ResolveFontLoc resolves a scalable font using the given resolver chain.
@@ -97,23 +313,13 @@ func (pipeline ResolverPipeline) Resolve(ctx context.Context, desc fontfind.Desc
 	if registry == nil {
 		registry = fontregistry.GlobalRegistry()
 	}
-	ch := make(chan fontPlusErr)
-	go func(ch chan<- fontPlusErr) {
-		result := searchScalableFont(ctx, registry, desc, pipeline.resolvers)
-		ch <- result
-		close(ch)
-	}(ch)
-	loader := fontLoader{}
-	// waitCtx is supplied by the caller when awaiting the promise.
-	loader.await = func(waitCtx context.Context) (fontfind.ScalableFont, error) {
-		select {
-		case <-waitCtx.Done():
-			return fontfind.NullFont, waitCtx.Err()
-		case r := <-ch:
-			return r.font, r.err
-		}
-	}
-	return loader
+	searchCtx, cancel := context.WithCancel(ctx)
+	promise := newFontPromise(cancel)
+	go func() {
+		defer cancel()
+		promise.complete(pipeline.search(searchCtx, registry, desc))
+	}()
+	return promise
 }
 
 func adaptLocator(r FontLocator) FontLocatorWithContext {
@@ -122,36 +328,130 @@ func adaptLocator(r FontLocator) FontLocatorWithContext {
 	}
 }
 
-func searchScalableFont(ctx context.Context, registry FontRegistry, desc fontfind.Descriptor, resolvers []FontLocatorWithContext) (result fontPlusErr) {
-	if err := ctx.Err(); err != nil {
-		result.err = err
-		return
-	}
+// searchScalableFont searches a font in the registry, then with the resolvers.
+// For a font stack (see fontfind.Descriptor.Families), the families of the
+// stack are searched in order, each with all the resolvers, and the first one
+// found wins. Resolvers are tried for every family of the alias rule for a
+// requested family, if any (see fontfind.AliasTable.Families).
+// If the registry implements NegativeCache, failed searches are remembered.
+// The search is recorded in a report.
+func (pipeline ResolverPipeline) searchScalableFont(ctx context.Context, registry FontRegistry,
+	desc fontfind.Descriptor) (result fontPlusErr) {
+	//
 	if registry == nil {
 		registry = fontregistry.GlobalRegistry()
 	}
-	name := fontregistry.NormalizeFontname(desc.Pattern, desc.Style, desc.Weight)
+	name := fontregistry.NormalizeDescriptor(desc)
+	report := &Report{Descriptor: desc, Key: name}
+	result.report = report
+	start := time.Now()
+	defer func() {
+		report.Font, report.Err = result.font, result.err
+		report.Duration = time.Since(start)
+	}()
+	if err := ctx.Err(); err != nil {
+		result.err = fontfind.Cancelled(err)
+		return
+	}
+	obs := pipeline.observer
 	if t, err := registry.GetFont(name); err == nil {
+		observe.Emit(obs, observe.Event{Kind: observe.CacheHit, Key: name})
+		report.RegistryHit = true
 		result.font = t
 		return
 	}
-	for _, resolver := range resolvers {
-		if err := ctx.Err(); err != nil {
-			result.err = err
+	observe.Emit(obs, observe.Event{Kind: observe.CacheMiss, Key: name})
+	negCache, _ := registry.(NegativeCache)
+	if negCache != nil {
+		if reason := negCache.Miss(name); reason != nil {
+			tracer().Debugf("font %s is a known miss", name)
+			observe.Emit(obs, observe.Event{Kind: observe.KnownMiss, Key: name, Err: reason})
+			observe.Emit(obs, observe.Event{Kind: observe.FallbackUsed, Key: name})
+			report.KnownMiss, report.FallbackUsed = true, true
+			result.err = reason
+			result.font, _ = fallbackFont(registry, desc)
 			return
 		}
-		if f, err := resolver(ctx, desc); err == nil {
-			registry.StoreFont(name, f)
-			result.font = f
-			return
-		} else if ctxErr := ctx.Err(); ctxErr != nil {
-			result.err = ctxErr
-			return
+	}
+	if obs != nil {
+		ctx = observe.WithObserver(ctx, obs)
+	}
+	var failures []error
+	for _, entry := range desc.FamilyStack() {
+		for _, family := range pipeline.aliasTable().Families(entry) {
+			candidate := desc
+			candidate.Pattern, candidate.Families = family, nil
+			candidateName := fontregistry.NormalizeDescriptor(candidate)
+			found := func(f fontfind.ScalableFont) {
+				report.Family = entry
+				if family != entry { // substitute family of an alias rule
+					report.Substitute = family
+				}
+				if candidateName != name {
+					registry.StoreFont(candidateName, f)
+				}
+				registry.StoreFont(name, f)
+				result.font = f
+			}
+			if candidateName != name {
+				if t, err := registry.GetFont(candidateName); err == nil {
+					tracer().Debugf("font %s found as cached font %s", name, candidateName)
+					found(t)
+					return
+				}
+			}
+			for i, resolver := range pipeline.resolvers {
+				if err := ctx.Err(); err != nil {
+					result.err = fontfind.Cancelled(err)
+					return
+				}
+				resolverName := pipeline.resolverName(i)
+				observe.Emit(obs, observe.Event{Kind: observe.ResolverStart, Key: candidateName, Resolver: resolverName})
+				attemptStart := time.Now()
+				f, err := resolver(ctx, candidate)
+				attempt := Attempt{Resolver: resolverName, Family: family, Duration: time.Since(attemptStart), Err: err}
+				observe.Emit(obs, observe.Event{Kind: observe.ResolverFinish, Key: candidateName, Resolver: resolverName,
+					Duration: attempt.Duration, Err: err})
+				if err == nil {
+					attempt.Font, attempt.Confidence = f.Name, f.Confidence
+				}
+				report.Attempts = append(report.Attempts, attempt)
+				if err == nil {
+					found(f)
+					return
+				} else if ctxErr := ctx.Err(); ctxErr != nil {
+					result.err = fontfind.Cancelled(ctxErr)
+					return
+				}
+				failures = append(failures, &fontfind.ResolverError{Resolver: attempt.Resolver, Err: err})
+			}
 		}
 	}
-	result.err = notFound(name)
-	if f, err := registry.FallbackFont(); err == nil {
+	resErr := &fontfind.ResolutionError{Key: name, Failures: failures}
+	if f, err := fallbackFont(registry, desc); err == nil {
+		report.FallbackUsed, resErr.Fallback = true, true
+		observe.Emit(obs, observe.Event{Kind: observe.FallbackUsed, Key: name, Err: resErr})
 		result.font = f
 	}
+	result.err = resErr
+	if ttl := pipeline.missTTLOrDefault(); negCache != nil && ttl > 0 && permanent(failures) {
+		negCache.StoreMiss(name, result.err, ttl)
+	}
 	return result
 }
+
+// permanent reports whether failures of resolvers are permanent, i.e. all the
+// resolvers have reported the font as not found. Other failures, e.g. of font
+// sources being unavailable, may be transient and are not remembered as misses,
+// and neither are lookups without any resolver having run.
+func permanent(failures []error) bool {
+	if len(failures) == 0 {
+		return false
+	}
+	for _, err := range failures {
+		if !errors.Is(err, fontfind.ErrNotFound) || errors.Is(err, fontfind.ErrSourceUnavailable) {
+			return false
+		}
+	}
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/fs"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -63,9 +64,20 @@ func loadFontConfigList(appkey string, io IO) ([]fontfind.FontVariantsLocation,
 	if err != nil {
 		return noFonts, false
 	}
-	r := bytes.NewReader(fclist)
-	scanner := bufio.NewScanner(r)
-	ttc := 0
+	descs, err := parseFontConfigList(fclist)
+	fontConfigDescriptors = append(fontConfigDescriptors, descs...)
+	if err != nil {
+		return fontConfigDescriptors, false
+	}
+	return fontConfigDescriptors, true
+}
+
+// parseFontConfigList parses the output of fc-list into a list of font
+// variants, one for each line. Every variant is named after the face's
+// fontconfig style (see fcVariant).
+func parseFontConfigList(fclist []byte) ([]fontfind.FontVariantsLocation, error) {
+	var descs []fontfind.FontVariantsLocation
+	scanner := bufio.NewScanner(bytes.NewReader(fclist))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -78,38 +90,76 @@ func loadFontConfigList(appkey string, io IO) ([]fontfind.FontVariantsLocation,
 		fontpath := strings.TrimSpace(fields[0])
 		fontname := strings.TrimSpace(fields[1])
 		fontname = strings.TrimPrefix(fontname, ".")
-		fontvari := strings.ToLower(fields[2])
-		if strings.HasSuffix(fontpath, ".ttc") {
-			ttc++
-			continue
-		}
+		fcstyle := fcStyle(fields[2])
 		desc := fontfind.FontVariantsLocation{
-			Family: fontname,
-			Path:   fontpath,
+			Family:   fontname,
+			Variants: []string{fcVariant(fcstyle)},
+			Path:     fontpath,
+			Stretch:  fontfind.StretchFromName(fontname + " " + fcstyle),
 		}
-		if strings.Contains(fontvari, "regular") {
-			desc.Variants = []string{"regular"}
-		} else if strings.Contains(fontvari, "text") {
-			desc.Variants = []string{"regular"}
-		} else if strings.Contains(fontvari, "light") {
-			desc.Variants = []string{"light"}
-		} else if strings.Contains(fontvari, "italic") {
-			desc.Variants = []string{"italic"}
-		} else if strings.Contains(fontvari, "bold") {
-			desc.Variants = []string{"bold"}
-		} else if strings.Contains(fontvari, "black") {
-			desc.Variants = []string{"bold"}
+		if fontfind.IsCollectionPath(fontpath) {
+			desc.Index = collectionIndex(fields[3:])
 		}
-		fontConfigDescriptors = append(fontConfigDescriptors, desc)
+		descs = append(descs, desc)
 	}
-	if err = scanner.Err(); err != nil {
-		err = fmt.Errorf("encountered a problem during reading of fontconfig font list: %s", fclist)
-		return fontConfigDescriptors, false
+	if err := scanner.Err(); err != nil {
+		return descs, fmt.Errorf("encountered a problem during reading of fontconfig font list: %w", err)
+	}
+	return descs, nil
+}
+
+// fcStyle extracts the style of a face from a "style=<style>" field of a
+// fontconfig list line. fontconfig may list localized names of the style,
+// separated by commas, of which the first one is used.
+func fcStyle(field string) string {
+	style := strings.TrimSpace(field)
+	style = strings.TrimPrefix(style, "style=")
+	style, _, _ = strings.Cut(style, ",")
+	return strings.TrimSpace(style)
+}
+
+// fcVariant converts a fontconfig style, e.g. "SemiBold Italic", to a font
+// variant name, as used by the Google Fonts directory, e.g. "600italic".
+// Unlike a keyword, the variant name retains style and numeric weight of the
+// face for font matching (see fontfind.VariantStyleAndWeight).
+func fcVariant(fcstyle string) string {
+	style, weight := fontfind.GuessStyleAndWeight(fcstyle)
+	variant := ""
+	if wc := fontfind.WeightClass(weight); wc != fontfind.WeightClass(font.WeightNormal) {
+		variant = strconv.Itoa(wc)
 	}
-	if ttc > 0 {
-		tracer().Infof("skipping %d platform fonts: TTC not yet supported", ttc)
+	switch style {
+	case font.StyleItalic:
+		variant += "italic"
+	case font.StyleOblique:
+		variant += "oblique"
 	}
-	return fontConfigDescriptors, true
+	if variant == "" {
+		return "regular"
+	}
+	return variant
+}
+
+// collectionIndex extracts the face index from an "index=<n>" field of a
+// fontconfig list line. fc-list will print it if called like
+//
+//	fc-list : file family style index
+//
+// For named instances of variable fonts, fontconfig encodes the instance
+// number in the upper 16 bits of the index. Only the face index in the lower
+// 16 bits is returned.
+//
+// If no index is present, collectionIndex returns -1.
+func collectionIndex(fields []string) int {
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if v, ok := strings.CutPrefix(f, "index="); ok {
+			if i, err := strconv.Atoi(v); err == nil && i >= 0 {
+				return i & 0xffff
+			}
+		}
+	}
+	return -1
 }
 
 var loadFontConfigListTask sync.Once
@@ -120,8 +170,8 @@ var fontConfigDescriptors []fontfind.FontVariantsLocation
 // system (https://www.freedesktop.org/wiki/Software/fontconfig/).
 // However, we need some preparation from the user to de-couple from the
 // fontconfig library.
-func findFontConfigFont(appkey string, io IO, pattern string, style font.Style, weight font.Weight) (
-	desc fontfind.FontVariantsLocation, variant string) {
+func findFontConfigFont(appkey string, io IO, fdesc fontfind.Descriptor) (
+	desc fontfind.FontVariantsLocation, variant string, confidence fontfind.MatchConfidence) {
 	//
 	loadFontConfigListTask.Do(func() {
 		_, loadedFontConfigListOK = loadFontConfigList(appkey, io)
@@ -130,11 +180,10 @@ func findFontConfigFont(appkey string, io IO, pattern string, style font.Style,
 	if !loadedFontConfigListOK {
 		return
 	}
-	var confidence fontfind.MatchConfidence
-	desc, variant, confidence = fontfind.ClosestMatch(fontConfigDescriptors, pattern, style, weight)
+	desc, variant, confidence = fontfind.ClosestMatchDescriptor(fontConfigDescriptors, fdesc)
 	tracer().Debugf("closest fontconfig match confidence for %s|%s= %d", desc.Family, variant, confidence)
 	if confidence > fontfind.LowConfidence {
 		return
 	}
-	return fontfind.FontVariantsLocation{}, ""
+	return fontfind.FontVariantsLocation{}, "", fontfind.NoConfidence
 }
@@ -0,0 +1,98 @@
+package systemfont
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font"
+)
+
+var fcTestList = `
+/usr/share/fonts/noto/NotoSans-Regular.ttf: Noto Sans:style=Regular
+/usr/share/fonts/noto/NotoSans-BoldItalic.ttf: Noto Sans:style=Bold Italic,Negreta cursiva,Fett Kursiv
+/usr/share/fonts/noto/NotoSans-SemiBold.ttf: Noto Sans:style=SemiBold
+/usr/share/fonts/noto/NotoSans-Medium.ttf: Noto Sans:style=Medium
+/usr/share/fonts/noto/NotoSans-Thin.ttf: Noto Sans:style=Thin
+/usr/share/fonts/noto/NotoSans-ExtraLightItalic.ttf: Noto Sans:style=ExtraLight Italic
+/usr/share/fonts/noto/NotoSans-CondensedBold.ttf: Noto Sans:style=Condensed Bold
+/usr/share/fonts/dejavu/DejaVuSans-Oblique.ttf: DejaVu Sans:style=Oblique
+/System/Library/Fonts/NotoSerifMyanmar.ttc: Noto Serif Myanmar,Noto Serif Myanmar Light:style=Light,Regular:index=2
+
+not a font line
+`
+
+func TestParseFontConfigList(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	descs, err := parseFontConfigList([]byte(fcTestList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		variant string
+		style   font.Style
+		weight  font.Weight
+		stretch fontfind.Stretch
+		index   int
+	}{
+		{"regular", font.StyleNormal, font.WeightNormal, fontfind.StretchNormal, 0},
+		{"700italic", font.StyleItalic, font.WeightBold, fontfind.StretchNormal, 0},
+		{"600", font.StyleNormal, font.WeightSemiBold, fontfind.StretchNormal, 0},
+		{"500", font.StyleNormal, font.WeightMedium, fontfind.StretchNormal, 0},
+		{"100", font.StyleNormal, font.WeightThin, fontfind.StretchNormal, 0},
+		{"200italic", font.StyleItalic, font.WeightExtraLight, fontfind.StretchNormal, 0},
+		{"700", font.StyleNormal, font.WeightBold, fontfind.StretchCondensed, 0},
+		{"oblique", font.StyleOblique, font.WeightNormal, fontfind.StretchNormal, 0},
+		{"300", font.StyleNormal, font.WeightLight, fontfind.StretchNormal, 2},
+	}
+	if len(descs) != len(expected) {
+		t.Fatalf("expected %d font variants, got %d", len(expected), len(descs))
+	}
+	for i, exp := range expected {
+		d := descs[i]
+		if len(d.Variants) != 1 || d.Variants[0] != exp.variant {
+			t.Errorf("line %d: expected variant %s, got %v", i+1, exp.variant, d.Variants)
+			continue
+		}
+		style, weight := fontfind.VariantStyleAndWeight(d.Variants[0])
+		if style != exp.style || weight != exp.weight {
+			t.Errorf("line %d: expected style %v and weight %v, got %v and %v", i+1, exp.style, exp.weight,
+				style, weight)
+		}
+		if d.FamilyStretch() != exp.stretch {
+			t.Errorf("line %d: expected stretch %v, got %v", i+1, exp.stretch, d.FamilyStretch())
+		}
+		if d.Index != exp.index {
+			t.Errorf("line %d: expected face index %d, got %d", i+1, exp.index, d.Index)
+		}
+	}
+}
+
+func TestMatchFontConfigList(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	descs, err := parseFontConfigList([]byte(fcTestList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		style  font.Style
+		weight font.Weight
+		path   string
+	}{
+		{font.StyleItalic, font.WeightBold, "NotoSans-BoldItalic.ttf"},
+		{font.StyleNormal, font.WeightSemiBold, "NotoSans-SemiBold.ttf"},
+		{font.StyleNormal, font.WeightMedium, "NotoSans-Medium.ttf"},
+		{font.StyleNormal, font.WeightNormal, "NotoSans-Regular.ttf"},
+	} {
+		desc := fontfind.Descriptor{Pattern: "Noto Sans", Style: test.style, Weight: test.weight}
+		match, variant, confidence := fontfind.ClosestMatchDescriptor(descs, desc)
+		if confidence <= fontfind.LowConfidence || match.Path != "/usr/share/fonts/noto/"+test.path {
+			t.Errorf("expected %s for %v/%v, got %s|%s (confidence %d)", test.path, test.style, test.weight,
+				match.Path, variant, confidence)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package systemfont
+
+import (
+	"os"
+	"sync"
+
+	"github.com/flopp/go-findfont"
+	"github.com/npillmayer/fontfind"
+)
+
+// systemFace is a face of a font file found in one of the platform's font
+// directories.
+type systemFace struct {
+	path string
+	info fontfind.FaceInfo
+}
+
+var scanMutex sync.Mutex // guards systemFaces and systemFacesScanned
+var systemFaces []systemFace
+var systemFacesScanned bool
+
+// scanSystemFonts reads the metadata of all font files in the platform's font
+// directories, once until Rescan is called. Font files which cannot be parsed
+// are skipped.
+func scanSystemFonts() []systemFace {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	if systemFacesScanned {
+		return systemFaces
+	}
+	paths := findfont.List()
+	for _, fpath := range paths {
+		faces, err := readFaceInfo(fpath)
+		if err != nil {
+			tracer().Debugf("skipping system font %s: %v", fpath, err)
+			continue
+		}
+		for _, fi := range faces {
+			systemFaces = append(systemFaces, systemFace{path: fpath, info: fi})
+		}
+	}
+	systemFacesScanned = true
+	tracer().Infof("scanned %d faces in %d system font files", len(systemFaces), len(paths))
+	return systemFaces
+}
+
+// readFaceInfo reads the metadata of the faces of a font file, without
+// reading the complete file.
+func readFaceInfo(fpath string) ([]fontfind.FaceInfo, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return fontfind.ReadFaceInfoAt(f)
+}
+
+// Rescan drops the faces found by scanning the platform's font directories,
+// which will be scanned again on the next request not resolved by fontconfig.
+// Call Rescan after fonts have been installed or removed. Fonts not found
+// before may be remembered as misses by a registry (see
+// fontregistry.Registry.InvalidateMisses).
+func Rescan() {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	systemFaces, systemFacesScanned = nil, false
+}
+
+// findSystemFace searches the platform's font directories for a face matching
+// desc. An exact family name match is preferred over a partial one, and the
+// closest face is selected by the CSS font matching algorithm (see
+// fontfind.MatchFaces).
+func findSystemFace(desc fontfind.Descriptor) (systemFace, fontfind.MatchConfidence, bool) {
+	faces := scanSystemFonts()
+	infos := make([]fontfind.FaceInfo, len(faces))
+	for i, face := range faces {
+		infos[i] = face.info
+	}
+	pos, confidence := fontfind.MatchFaces(infos, desc)
+	if confidence <= fontfind.LowConfidence {
+		return systemFace{}, fontfind.NoConfidence, false
+	}
+	return faces[pos], confidence, true
+}
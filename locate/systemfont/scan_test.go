@@ -0,0 +1,31 @@
+package systemfont
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestRescan(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "resources")
+	defer teardown()
+	//
+	faces, err := readFaceInfo("../fallbackfont/packaged/Go-Regular.otf")
+	if err != nil || len(faces) != 1 || faces[0].PreferredFamily() != "Go" {
+		t.Fatalf("expected metadata of Go-Regular.otf, got %+v (%v)", faces, err)
+	}
+	scanMutex.Lock()
+	systemFaces = []systemFace{{path: "Go-Regular.otf", info: faces[0]}}
+	systemFacesScanned = true
+	scanMutex.Unlock()
+	if face, _, ok := findSystemFace(fontfind.Descriptor{Pattern: "Go"}); !ok || face.path != "Go-Regular.otf" {
+		t.Fatalf("expected scanned face to be found, got %+v", face)
+	}
+	Rescan()
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	if systemFacesScanned || len(systemFaces) != 0 {
+		t.Errorf("expected Rescan to drop scanned faces")
+	}
+}
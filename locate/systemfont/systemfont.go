@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/flopp/go-findfont"
 	"github.com/npillmayer/fontfind"
@@ -32,10 +33,7 @@ func Find(appkey string, io IO) locate.FontLocator {
 		io = &systemIO{}
 	}
 	return func(descr fontfind.Descriptor) (fontfind.ScalableFont, error) {
-		pattern := descr.Pattern
-		style := descr.Style
-		weight := descr.Weight
-		return FindLocalFont(appkey, io, pattern, style, weight)
+		return findLocalFont(appkey, io, descr)
 	}
 }
 
@@ -66,46 +64,117 @@ func (s *systemIO) ReadAll(r io.Reader) ([]byte, error) {
 // system (https://www.freedesktop.org/wiki/Software/fontconfig/).
 //
 // If fontconfig is not configured, FindLocalFont will fall back to scanning
-// system font folders (OS dependent).
+// system font folders (OS dependent). Font files found there are matched on
+// metadata read from their font tables. Only if this fails, FindLocalFont will
+// try to match font file names.
 func FindLocalFont(appkey string, io IO, pattern string, style font.Style, weight font.Weight) (
 	fontfind.ScalableFont, error) {
 	//
+	desc := fontfind.Descriptor{Pattern: pattern, Style: style, Weight: weight}
+	return findLocalFont(appkey, io, desc)
+}
+
+func findLocalFont(appkey string, io IO, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
 	if io == nil {
 		io = &systemIO{}
 	}
-	variants, _ := findFontConfigFont(appkey, io, pattern, style, weight)
+	pattern := desc.Pattern
+	if fontfind.IsGenericFamily(pattern) { // resolved by alias rules, not by name matching
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: pattern, Source: string(fontfind.SourceSystem)}
+	}
+	variants, variant, confidence := findFontConfigFont(appkey, io, desc)
 	if variants.Family != "" {
-		if fsys, path, err := wrapDirFS(variants.Path); err == nil {
-			sfnt := fontfind.ScalableFont{
-				Name:   pattern,
-				Weight: weight,
-				Style:  style,
-			}
-			sfnt.SetFS(fsys, path)
-			return sfnt, nil
+		fsys, path, err := wrapDirFS(variants.Path)
+		if err != nil {
+			return fontfind.NullFont, errors.New("path error with fontconfig file path")
+		}
+		family, _, _ := strings.Cut(variants.Family, ",")
+		index := variants.Index
+		if fontfind.IsCollectionPath(path) && index < 0 {
+			faceDesc := desc
+			faceDesc.Pattern = family
+			index = collectionFace(fsys, path, faceDesc)
+		}
+		sfnt := newSystemFont(fsys, path, max(index, 0), confidence)
+		sfnt.SetHostPath(variants.Path)
+		if sfnt.Family == "" { // font file not readable, use fontconfig's view
+			sfnt.Family = family
+			sfnt.Style, sfnt.Weight = fontfind.VariantStyleAndWeight(variant)
 		}
-		return fontfind.NullFont, errors.New("path error with fontconfig file path")
+		sfnt.SelectInstance(desc)
+		return sfnt, nil
 	}
 	if loadedFontConfigListOK { // fontconfig is active, but didn't find a font
 		// therefore don't do a file system scan
-		return fontfind.NullFont, errors.New("no such font")
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: pattern, Source: string(fontfind.SourceSystem)}
 	}
 	// otherwise fontconfig is not active => scan file system
+	if face, confidence, ok := findSystemFace(desc); ok {
+		tracer().Debugf("%s is a system font: %s, face #%d", pattern, face.path, face.info.Index)
+		fsys, path, err := wrapDirFS(face.path)
+		if err != nil {
+			return fontfind.NullFont, errors.New("path error with system font file path")
+		}
+		sfnt := newSystemFont(fsys, path, face.info.Index, confidence)
+		sfnt.SetHostPath(face.path)
+		sfnt.SetMetadata(face.info)
+		sfnt.SelectInstance(desc)
+		return sfnt, nil
+	}
+	// as a last resort, try to match the font's file name
 	fpath, err := findfont.Find(pattern) // go-findfont lib does not accept style & weight
 	if err == nil && fpath != "" {
 		tracer().Debugf("%s is a system font: %s", pattern, fpath)
-		if fsys, path, err := wrapDirFS(fpath); err == nil {
-			sfnt := fontfind.ScalableFont{
-				Name:   pattern,
-				Weight: weight,
-				Style:  style,
-			}
-			sfnt.SetFS(fsys, path)
-			return sfnt, nil
+		fsys, path, err := wrapDirFS(fpath)
+		if err != nil {
+			return fontfind.NullFont, errors.New("path error with system font file path")
+		}
+		index := 0
+		if fontfind.IsCollectionPath(path) {
+			index = collectionFace(fsys, path, desc)
+		}
+		sfnt := newSystemFont(fsys, path, index, fontfind.LowConfidence)
+		sfnt.SetHostPath(fpath)
+		if sfnt.Family == "" {
+			sfnt.Family = pattern
+			sfnt.Style, sfnt.Weight = fontfind.GuessStyleAndWeight(path)
 		}
-		return fontfind.NullFont, errors.New("path error with system font file path")
+		sfnt.SelectInstance(desc)
+		return sfnt, nil
+	}
+	return fontfind.NullFont, &fontfind.NotFoundError{Name: pattern, Source: string(fontfind.SourceSystem)}
+}
+
+// newSystemFont creates a scalable font for face number index of a local font
+// file. Family, style and weight are taken from the font's metadata. If the
+// font file cannot be read, they are left empty.
+func newSystemFont(fsys fs.FS, path string, index int, confidence fontfind.MatchConfidence) fontfind.ScalableFont {
+	sfnt := fontfind.ScalableFont{
+		Name:       path,
+		Confidence: confidence,
+		Source:     fontfind.SourceSystem,
+	}
+	sfnt.SetFS(fsys, path)
+	sfnt.SetCollectionIndex(index)
+	if fi, err := sfnt.Metadata(); err == nil {
+		sfnt.SetMetadata(fi)
+	}
+	return sfnt
+}
+
+// collectionFace searches the faces of a font collection for a face matching
+// desc. If the collection cannot be read or no face matches, the first face
+// of the collection is selected.
+func collectionFace(fsys fs.FS, path string, desc fontfind.Descriptor) int {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		tracer().Errorf("cannot read font collection %s: %v", path, err)
+		return 0
+	}
+	if index, ok := fontfind.MatchCollectionFace(data, desc); ok {
+		return index
 	}
-	return fontfind.NullFont, errors.New("no such font")
+	return 0
 }
 
 func wrapDirFS(fontpath string) (fs.FS, string, error) {
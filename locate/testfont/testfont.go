@@ -2,12 +2,10 @@ package testfont
 
 import (
 	"embed"
-	"errors"
 
 	"github.com/npillmayer/fontfind"
 	"github.com/npillmayer/fontfind/locate"
 	"github.com/npillmayer/schuko/tracing"
-	"golang.org/x/image/font"
 )
 
 // tracer writes to trace with key 'testfont'
@@ -16,44 +14,55 @@ func tracer() tracing.Trace {
 }
 
 // Find creates a locator that resolves fonts from the embedded fallback set.
+// Requests not matching any test font are reported as not found.
 func Find(testdata embed.FS) locate.FontLocator {
 	return func(descr fontfind.Descriptor) (fontfind.ScalableFont, error) {
-		pattern := descr.Pattern
-		style := descr.Style
-		weight := descr.Weight
-		return findTestFont(testdata, pattern, style, weight)
+		f, err := findTestFont(testdata, descr)
+		if err == nil && f.Confidence == fontfind.NoConfidence {
+			return fontfind.NullFont, &fontfind.NotFoundError{Name: descr.Pattern, Source: string(fontfind.SourceTestdata)}
+		}
+		return f, err
 	}
 }
 
 // findTestFont looks up a matching font in embedded fallback resources.
 // If no match exists, it returns the first available packaged font.
-func findTestFont(testdata embed.FS, pattern string, style font.Style, weight font.Weight) (
-	fontfind.ScalableFont, error) {
+func findTestFont(testdata embed.FS, desc fontfind.Descriptor) (fontfind.ScalableFont, error) {
 	//
 	fontDir, err := testdata.ReadDir("testdata")
 	if err != nil {
 		return fontfind.NullFont, err
 	}
-	var fname string // path to embedded font, if any
+	var fname string           // path to embedded font, if any
+	var face fontfind.FaceInfo // metadata of the selected face
+	confidence := fontfind.NoConfidence
 	for _, f := range fontDir {
 		if f.IsDir() {
 			continue
 		}
-		if fontfind.Matches(f.Name(), pattern, style, weight) {
-			tracer().Debugf("found embedded font file %s", f.Name())
-			fname = f.Name()
+		data, err := testdata.ReadFile("testdata/" + f.Name())
+		if err != nil {
+			continue
+		}
+		fi, c := fontfind.MatchFontFile(data, f.Name(), desc)
+		if fname == "" || c > confidence {
+			fname, face, confidence = f.Name(), fi, c
+		}
+		if confidence == fontfind.PerfectConfidence {
+			tracer().Debugf("found embedded font file %s, face #%d", f.Name(), fi.Index)
 			break
 		}
-		fname = f.Name()
 	}
-	var sFont fontfind.ScalableFont
 	if fname == "" {
-		return fontfind.NullFont, errors.New("font not found")
+		return fontfind.NullFont, &fontfind.NotFoundError{Name: desc.Pattern, Source: string(fontfind.SourceTestdata)}
+	}
+	sFont := fontfind.ScalableFont{
+		Name:       fname,
+		Confidence: confidence,
+		Source:     fontfind.SourceTestdata,
 	}
-	// font is packaged embedded font from testdata directory
-	sFont.Name = fname
-	sFont.Style = style
-	sFont.Weight = weight
 	sFont.SetFS(testdata, "testdata/"+fname)
+	sFont.SetMetadata(face)
+	sFont.SelectInstance(desc)
 	return sFont, nil
 }
@@ -0,0 +1,256 @@
+package locate
+
+import (
+	"context"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/npillmayer/fontfind"
+	"github.com/npillmayer/fontfind/fontregistry"
+)
+
+// TextRun is a run of text of a single script, bound to a font covering the
+// runes of the run.
+type TextRun struct {
+	Text       string                // text of the run
+	Start, End int                   // byte offsets of the run within the text
+	Script     string                // Unicode script of the run, e.g. "Latin" (see unicode.Scripts)
+	Font       fontfind.ScalableFont // font to use for the run
+	Descriptor fontfind.Descriptor   // descriptor Font has been resolved for
+	Covered    bool                  // false if no font of the font stack covers the run
+}
+
+// coverageRegistry is implemented by font registries which cache the Unicode
+// coverage of their fonts, e.g. fontregistry.Registry.
+type coverageRegistry interface {
+	Coverage(normalizedName string) (*fontfind.Coverage, error)
+}
+
+// ResolveText resolves fonts for a text which may contain runes of more
+// than one script. The text is itemized by script, and every run is bound to
+// the first font of the font stack (primary, followed by fallbacks) covering
+// it. If none of the fonts covers a run completely, the run is split further,
+// rune by rune, into runs covered by a single font. Runes no font of the stack
+// covers are bound to the primary font and flagged as not covered.
+//
+// Fonts are resolved by the pipeline's resolvers and cached in its registry,
+// as with Resolve. Fallback fonts are resolved only if needed. If the primary
+// font cannot be resolved, the registry's fallback font takes its place and
+// the resolution error is returned together with the runs.
+//
+// Other than Resolve, ResolveText works synchronously.
+func (pipeline ResolverPipeline) ResolveText(ctx context.Context, primary fontfind.Descriptor,
+	fallbacks []fontfind.Descriptor, text string) ([]TextRun, error) {
+	//
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	registry := pipeline.registry
+	if registry == nil {
+		registry = fontregistry.GlobalRegistry()
+	}
+	stack := &fontStack{
+		ctx:      ctx,
+		registry: registry,
+		pipeline: pipeline,
+		descs:    append([]fontfind.Descriptor{primary}, fallbacks...),
+	}
+	primaryFont, err := stack.font(0)
+	if primaryFont == nil {
+		return nil, err
+	}
+	var runs []TextRun
+	for _, srun := range itemizeByScript(text) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fontfind.Cancelled(ctxErr)
+		}
+		runs = append(runs, stack.bind(text, srun)...)
+	}
+	return runs, err
+}
+
+// --- Font stack ------------------------------------------------------------
+
+// stackFont is a resolved font of a font stack, together with its coverage.
+type stackFont struct {
+	desc     fontfind.Descriptor
+	font     fontfind.ScalableFont
+	coverage *fontfind.Coverage
+}
+
+// fontStack resolves the fonts of a font stack lazily.
+type fontStack struct {
+	ctx      context.Context
+	registry FontRegistry
+	pipeline ResolverPipeline
+	descs    []fontfind.Descriptor
+	fonts    []*stackFont // resolved fonts, nil if not resolvable
+	resolved int          // number of entries of descs tried
+}
+
+// font returns entry i of the font stack, resolving it if necessary.
+// Entries which cannot be resolved are nil, except for the primary font,
+// which is replaced by the registry fallback font.
+func (stack *fontStack) font(i int) (*stackFont, error) {
+	var err error
+	for stack.resolved <= i && stack.resolved < len(stack.descs) {
+		desc := stack.descs[stack.resolved]
+		result := stack.pipeline.search(stack.ctx, stack.registry, desc)
+		var sf *stackFont
+		if result.err == nil || (stack.resolved == 0 && result.font != fontfind.NullFont) {
+			sf = &stackFont{desc: desc, font: result.font}
+			sf.coverage = stack.coverage(desc, result.font, result.err == nil)
+		}
+		if result.err != nil {
+			tracer().Infof("cannot resolve font %v for text: %v", desc, result.err)
+			if stack.resolved == 0 {
+				err = result.err
+			}
+		}
+		stack.fonts = append(stack.fonts, sf)
+		stack.resolved++
+	}
+	if i >= len(stack.fonts) {
+		return nil, err
+	}
+	return stack.fonts[i], err
+}
+
+// coverage returns the Unicode coverage of a font. If the font is contained in
+// the registry and the registry caches coverage, the cached coverage is used.
+// Fonts whose coverage cannot be read cover nothing.
+func (stack *fontStack) coverage(desc fontfind.Descriptor, f fontfind.ScalableFont, registered bool) *fontfind.Coverage {
+	if cr, ok := stack.registry.(coverageRegistry); ok && registered {
+		if c, err := cr.Coverage(fontregistry.NormalizeDescriptor(desc)); err == nil {
+			return c
+		}
+	}
+	c, err := f.Coverage()
+	if err != nil {
+		tracer().Errorf("cannot read coverage of font %s: %v", f.Name, err)
+		return &fontfind.Coverage{}
+	}
+	return c
+}
+
+// covering returns the first font of the stack covering text completely, or
+// nil.
+func (stack *fontStack) covering(text string) *stackFont {
+	for i := range stack.descs {
+		if sf, _ := stack.font(i); sf != nil && sf.coverage.Covers(text) {
+			return sf
+		}
+	}
+	return nil
+}
+
+// bind binds a script run to fonts of the stack.
+func (stack *fontStack) bind(text string, srun scriptRun) []TextRun {
+	primary, _ := stack.font(0)
+	newRun := func(start, end int, sf *stackFont, covered bool) TextRun {
+		return TextRun{
+			Text: text[start:end], Start: start, End: end, Script: srun.script,
+			Font: sf.font, Descriptor: sf.desc, Covered: covered,
+		}
+	}
+	if sf := stack.covering(text[srun.start:srun.end]); sf != nil {
+		return []TextRun{newRun(srun.start, srun.end, sf, true)}
+	}
+	// no single font covers the run ⇒ split it rune by rune, preferring
+	// the font of the previous rune
+	var runs []TextRun
+	var current *stackFont
+	start := srun.start
+	for pos := srun.start; pos < srun.end; {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		sf := current
+		switch {
+		case pos == srun.start:
+			sf = stack.covering(string(r))
+		case ignorable(r): // white space and marks stick to the current font
+		case current == nil || !current.coverage.HasGlyph(r):
+			sf = stack.covering(string(r))
+		}
+		if pos > start && sf != current {
+			runs = append(runs, newRun(start, pos, orPrimary(current, primary), current != nil))
+			start = pos
+		}
+		current = sf
+		pos += size
+	}
+	return append(runs, newRun(start, srun.end, orPrimary(current, primary), current != nil))
+}
+
+func orPrimary(sf, primary *stackFont) *stackFont {
+	if sf == nil {
+		return primary
+	}
+	return sf
+}
+
+func ignorable(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r) || unicode.Is(unicode.Inherited, r)
+}
+
+// --- Script itemization ----------------------------------------------------
+
+// scriptRun is a run of text of a single script.
+type scriptRun struct {
+	start, end int
+	script     string
+}
+
+// scriptNames lists the names of unicode.Scripts, with the most frequent
+// scripts first.
+var scriptNames = func() []string {
+	names := make([]string, 0, len(unicode.Scripts))
+	for name := range unicode.Scripts {
+		if name != "Latin" && name != "Common" && name != "Inherited" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"Latin", "Common", "Inherited"}, names...)
+}()
+
+// scriptOf returns the Unicode script of a rune.
+func scriptOf(r rune) string {
+	for _, name := range scriptNames {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	return "Common"
+}
+
+// itemizeByScript splits text into runs of a single script. Runes of the
+// Common and Inherited scripts (e.g., white space, punctuation and combining
+// marks) belong to the run of the preceding rune, or to the run of the
+// following rune at the start of the text.
+func itemizeByScript(text string) []scriptRun {
+	var runs []scriptRun
+	for pos := 0; pos < len(text); {
+		r, size := utf8.DecodeRuneInString(text[pos:]) // size is 1 for invalid UTF-8
+		script := scriptOf(r)
+		end := pos + size
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			if script == "Common" || script == "Inherited" || script == last.script {
+				last.end = end
+				pos = end
+				continue
+			}
+			if last.script == "Common" { // leading common runes
+				last.script, last.end = script, end
+				pos = end
+				continue
+			}
+		} else if script == "Inherited" {
+			script = "Common"
+		}
+		runs = append(runs, scriptRun{start: pos, end: end, script: script})
+		pos = end
+	}
+	return runs
+}
@@ -1,6 +1,7 @@
 package fontfind
 
 import (
+	"math"
 	"path"
 	"regexp"
 	"strconv"
@@ -14,6 +15,38 @@ type FontVariantsLocation struct {
 	Family   string   `json:"family"`
 	Variants []string `json:"variants"`
 	Path     string   // used for local font sources
+	Index    int      // face index within a font collection, -1 if not known for a collection
+	Stretch  Stretch  `json:"-"` // width of the font, zero for normal width
+}
+
+// FamilyStretch returns the width of a font family. If it has not been set
+// explicitly, it is guessed from the family name.
+func (fvl FontVariantsLocation) FamilyStretch() Stretch {
+	if fvl.Stretch > 0 {
+		return fvl.Stretch
+	}
+	return StretchFromName(fvl.Family)
+}
+
+// narrowByStretch selects the font families with the width closest to a
+// requested stretch from a list, following CSS font matching rules (see
+// ClosestStretch).
+func narrowByStretch(fdescs []FontVariantsLocation, stretch Stretch) []FontVariantsLocation {
+	if len(fdescs) == 0 {
+		return fdescs
+	}
+	available := make([]Stretch, len(fdescs))
+	for i, fdesc := range fdescs {
+		available[i] = fdesc.FamilyStretch()
+	}
+	closest := ClosestStretch(available, stretch)
+	narrowed := make([]FontVariantsLocation, 0, len(fdescs))
+	for i, fdesc := range fdescs {
+		if available[i] == closest {
+			narrowed = append(narrowed, fdesc)
+		}
+	}
+	return narrowed
 }
 
 // Matches returns true if a font's filename contains pattern and indicators
@@ -44,44 +77,96 @@ const (
 )
 
 // ClosestMatch scans a list of font descriptors and returns the closest match
-// for a given set of parameters.
+// for a given set of parameters. Variants are matched following the CSS font
+// matching algorithm (see FindClosestFace). If more than one family matches
+// pattern, the family with the best matching variant is selected.
 //
 // If no variant matches, returns `NoConfidence`.
 func ClosestMatch(fdescs []FontVariantsLocation, pattern string, style font.Style,
 	weight font.Weight) (match FontVariantsLocation, variant string, confidence MatchConfidence) {
 	//
-	r, err := regexp.Compile(strings.ToLower(pattern))
+	desc := Descriptor{Pattern: pattern, Style: style, Weight: weight}
+	return closestMatch(fdescs, desc)
+}
+
+// ClosestMatchDescriptor scans a list of font descriptors and returns the closest
+// match for a font descriptor. Other than ClosestMatch, it honours the font
+// width requested by desc: among the families matching desc.Pattern, those
+// with the closest width are considered (see ClosestStretch). Numeric weights
+// (see Descriptor.WeightValue) are honoured as well.
+//
+// If no variant matches, returns `NoConfidence`.
+func ClosestMatchDescriptor(fdescs []FontVariantsLocation, desc Descriptor) (
+	match FontVariantsLocation, variant string, confidence MatchConfidence) {
+	//
+	r, err := regexp.Compile(strings.ToLower(desc.Pattern))
+	if err != nil {
+		tracer().Errorf("invalid font name pattern")
+		return
+	}
+	var candidates []FontVariantsLocation
+	for _, fdesc := range fdescs {
+		if r.MatchString(strings.ToLower(fdesc.Family)) {
+			candidates = append(candidates, fdesc)
+		}
+	}
+	candidates = narrowByStretch(candidates, desc.Stretch)
+	return closestMatch(candidates, desc)
+}
+
+func closestMatch(fdescs []FontVariantsLocation, desc Descriptor) (
+	match FontVariantsLocation, variant string, confidence MatchConfidence) {
+	//
+	r, err := regexp.Compile(strings.ToLower(desc.Pattern))
 	if err != nil {
 		tracer().Errorf("invalid font name pattern")
 		return
 	}
 	for _, fdesc := range fdescs {
-		//trace().Debugf("trying to match %s", strings.ToLower(fdesc.Family))
 		if !r.MatchString(strings.ToLower(fdesc.Family)) {
 			continue
 		}
-		for _, v := range fdesc.Variants {
-			s := MatchStyle(v, style)
-			w := MatchWeight(v, weight)
-			if (s+w)/2 > confidence {
-				//trace().Debugf("variant %+v match confidence = %d + %d", v, s, w)
-				confidence = (s + w) / 2
-				variant = v
-				match = fdesc
-			}
+		if v, c := fdesc.ClosestVariant(desc); c > confidence {
+			confidence, variant, match = c, v, fdesc
 		}
 	}
 	return
 }
 
+// ClosestVariant selects the variant of a font family closest to a font
+// descriptor, following the CSS font matching algorithm (see
+// FindClosestFace). desc.Pattern is not considered.
+//
+// If the family has no variants, ClosestVariant returns `NoConfidence`.
+func (fvl FontVariantsLocation) ClosestVariant(desc Descriptor) (string, MatchConfidence) {
+	faces := make([]FaceProperties, len(fvl.Variants))
+	for i, v := range fvl.Variants {
+		faces[i] = VariantProperties(v, fvl.FamilyStretch())
+	}
+	i, confidence := FindClosestFace(faces, desc)
+	if i < 0 {
+		return "", NoConfidence
+	}
+	return fvl.Variants[i], confidence
+}
+
 // ---------------------------------------------------------------------------
 
 // GuessStyleAndWeight tries to guess a font's style and weight from the
 // font's file name.
+//
+// Guessing from file names is unreliable and should be used as a last resort
+// only, if a font's metadata cannot be read (see ReadFaceInfo).
 func GuessStyleAndWeight(fontfilename string) (font.Style, font.Weight) {
 	fontfilename = path.Base(fontfilename)
 	ext := path.Ext(fontfilename)
-	fontfilename = strings.ToLower(fontfilename[:len(fontfilename)-len(ext)])
+	return guessFromName(fontfilename[:len(fontfilename)-len(ext)])
+}
+
+// guessFromName guesses style and weight from a font name without file
+// extension, e.g. "Clarendon-Bold" or a subfamily name like "Bold Italic".
+func guessFromName(fontname string) (font.Style, font.Weight) {
+	fontfilename := strings.ToLower(fontname)
 	s := strings.Split(fontfilename, "-")
 	if len(s) > 1 {
 		switch s[len(s)-1] {
@@ -98,107 +183,72 @@ func GuessStyleAndWeight(fontfilename string) (font.Style, font.Weight) {
 	style, weight := font.StyleNormal, font.WeightNormal
 	if strings.Contains(fontfilename, "italic") {
 		style = font.StyleItalic
+	} else if strings.Contains(fontfilename, "oblique") {
+		style = font.StyleOblique
 	}
-	if strings.Contains(fontfilename, "light") {
+	// check compound weight names first, as e.g. "semibold" contains "bold"
+	switch {
+	case strings.Contains(fontfilename, "extralight"), strings.Contains(fontfilename, "ultralight"):
+		weight = font.WeightExtraLight
+	case strings.Contains(fontfilename, "light"):
 		weight = font.WeightLight
-	}
-	if strings.Contains(fontfilename, "bold") {
+	case strings.Contains(fontfilename, "thin"), strings.Contains(fontfilename, "hairline"):
+		weight = font.WeightThin
+	case strings.Contains(fontfilename, "semibold"), strings.Contains(fontfilename, "demibold"):
+		weight = font.WeightSemiBold
+	case strings.Contains(fontfilename, "extrabold"), strings.Contains(fontfilename, "ultrabold"):
+		weight = font.WeightExtraBold
+	case strings.Contains(fontfilename, "bold"):
 		weight = font.WeightBold
+	case strings.Contains(fontfilename, "black"), strings.Contains(fontfilename, "heavy"):
+		weight = font.WeightBlack
+	case strings.Contains(fontfilename, "medium"):
+		weight = font.WeightMedium
 	}
 	return style, weight
 }
 
-// MatchStyle tries to match a font-variant to a given style.
-func MatchStyle(variantName string, style font.Style) MatchConfidence {
-	variantName = strings.ToLower(variantName)
-	switch style {
-	case font.StyleNormal:
-		switch variantName {
-		case "regular", "400":
-			return PerfectConfidence
-		case "100", "200", "300", "500":
-			return HighConfidence
-		}
-		return NoConfidence
-	case font.StyleItalic:
-		if strings.Contains(variantName, "italic") {
-			return PerfectConfidence
-		}
-		if strings.Contains(variantName, "obliq") {
-			return HighConfidence
-		}
-		return NoConfidence
-	case font.StyleOblique:
-		if strings.Contains(variantName, "obliq") {
-			return PerfectConfidence
-		}
-		if strings.Contains(variantName, "italic") {
-			return HighConfidence
+// VariantStyleAndWeight interprets a font variant name, as used by the Google
+// Fonts directory (e.g., "regular", "italic", "700", "300italic"), and returns
+// the style and weight it denotes.
+func VariantStyleAndWeight(variantName string) (font.Style, font.Weight) {
+	style, weight := variantStyleAndWeightValue(variantName)
+	return style, WeightFromClass(int(math.Round(float64(weight))))
+}
+
+// variantStyleAndWeightValue interprets a font variant name like
+// VariantStyleAndWeight does, but returns a numeric weight (1…1000).
+func variantStyleAndWeightValue(variantName string) (font.Style, float32) {
+	v := strings.ToLower(strings.TrimSpace(variantName))
+	style := font.StyleNormal
+	if rest, ok := strings.CutSuffix(v, "italic"); ok {
+		style, v = font.StyleItalic, rest
+	} else if rest, ok := strings.CutSuffix(v, "oblique"); ok {
+		style, v = font.StyleOblique, rest
+	}
+	if wc, err := strconv.Atoi(v); err == nil {
+		if wc > 0 && wc < 10 { // legacy weight classes 1…9
+			wc *= 100
 		}
-		return NoConfidence
+		return style, float32(wc)
+	}
+	if v == "" {
+		return style, float32(WeightClass(font.WeightNormal))
 	}
-	return NoConfidence
+	_, weight := guessFromName(v)
+	return style, float32(WeightClass(weight))
+}
+
+// MatchStyle rates how well a font-variant matches a given style
+// (see StyleConfidence).
+func MatchStyle(variantName string, style font.Style) MatchConfidence {
+	s, _ := variantStyleAndWeightValue(variantName)
+	return StyleConfidence(s, style)
 }
 
-// MatchWeight tries to match a font-variant to a given weight.
+// MatchWeight rates how well a font-variant matches a given weight
+// (see WeightConfidence).
 func MatchWeight(variantName string, weight font.Weight) MatchConfidence {
-	/* from https://pkg.go.dev/golang.org/x/image/font
-	WeightThin       Weight = -3 // CSS font-weight value 100.
-	WeightExtraLight Weight = -2 // CSS font-weight value 200.
-	WeightLight      Weight = -1 // CSS font-weight value 300.
-	WeightNormal     Weight = +0 // CSS font-weight value 400.
-	WeightMedium     Weight = +1 // CSS font-weight value 500.
-	WeightSemiBold   Weight = +2 // CSS font-weight value 600.
-	WeightBold       Weight = +3 // CSS font-weight value 700.
-	WeightExtraBold  Weight = +4 // CSS font-weight value 800.
-	WeightBlack      Weight = +5 // CSS font-weight value 900.
-	*/
-	if strconv.Itoa(int(weight)+4*100) == variantName {
-		return PerfectConfidence
-	}
-	switch variantName {
-	case "regular", "400", "italic", "oblique", "normal", "text":
-		switch weight {
-		case font.WeightNormal, font.WeightMedium:
-			return PerfectConfidence
-		case font.WeightThin, font.WeightExtraLight, font.WeightLight:
-			return LowConfidence
-		}
-		return NoConfidence
-	case "100", "200", "300":
-		switch weight {
-		case font.WeightThin, font.WeightExtraLight, font.WeightLight:
-			return PerfectConfidence
-		case font.WeightNormal, font.WeightMedium:
-			return LowConfidence
-		}
-		return NoConfidence
-	case "500":
-		switch weight {
-		case font.WeightMedium:
-			return PerfectConfidence
-		case font.WeightSemiBold:
-			return HighConfidence
-		case font.WeightNormal, font.WeightBold:
-			return LowConfidence
-		}
-		return NoConfidence
-	case "bold", "700":
-		switch weight {
-		case font.WeightBold:
-			return PerfectConfidence
-		case font.WeightSemiBold, font.WeightExtraBold:
-			return HighConfidence
-		}
-		return NoConfidence
-	case "extrabold", "600", "800", "900":
-		switch weight {
-		case font.WeightSemiBold:
-			return LowConfidence
-		case font.WeightBold:
-			return HighConfidence
-		}
-		return NoConfidence
-	}
-	return NoConfidence
+	_, w := variantStyleAndWeightValue(variantName)
+	return WeightConfidence(w, float32(WeightClass(weight)))
 }
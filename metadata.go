@@ -0,0 +1,381 @@
+package fontfind
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// FaceInfo holds metadata for a single face of a font file, as read from the
+// font's tables. See
+// https://docs.microsoft.com/en-us/typography/opentype/spec/name and
+// https://docs.microsoft.com/en-us/typography/opentype/spec/os2
+type FaceInfo struct {
+	Index                int             // index of the face within a collection, 0 for single fonts
+	Family               string          // family name (name ID 1)
+	Subfamily            string          // subfamily name (name ID 2), e.g. "Bold Italic"
+	TypographicFamily    string          // typographic family name (name ID 16), may be empty
+	TypographicSubfamily string          // typographic subfamily name (name ID 17), may be empty
+	WeightClass          int             // OS/2 usWeightClass (1…1000), 0 if unknown
+	WidthClass           int             // OS/2 usWidthClass (1…9), 0 if unknown
+	Italic               bool            // OS/2 fsSelection bit 0
+	Bold                 bool            // OS/2 fsSelection bit 5
+	Oblique              bool            // OS/2 fsSelection bit 9
+	OpticalSizeMin       float32         // lower end of optical size range in points, 0 if unknown
+	OpticalSizeMax       float32         // upper end of optical size range in points, 0 if unknown
+	Axes                 []Axis          // variation axes, empty for static fonts
+	Instances            []NamedInstance // named instances of a variable font
+	hasOS2               bool
+}
+
+// PreferredFamily returns the typographic family name of a face if present,
+// and the legacy family name otherwise.
+func (fi FaceInfo) PreferredFamily() string {
+	if fi.TypographicFamily != "" {
+		return fi.TypographicFamily
+	}
+	return fi.Family
+}
+
+// PreferredSubfamily returns the typographic subfamily name of a face if
+// present, and the legacy subfamily name otherwise.
+func (fi FaceInfo) PreferredSubfamily() string {
+	if fi.TypographicSubfamily != "" {
+		return fi.TypographicSubfamily
+	}
+	return fi.Subfamily
+}
+
+// Style returns the style of a face. It is taken from the OS/2 table if
+// present, otherwise it is guessed from the subfamily name.
+func (fi FaceInfo) Style() font.Style {
+	if fi.hasOS2 {
+		switch {
+		case fi.Oblique:
+			return font.StyleOblique
+		case fi.Italic:
+			return font.StyleItalic
+		}
+		return font.StyleNormal
+	}
+	s, _ := guessFromName(fi.PreferredSubfamily())
+	return s
+}
+
+// Weight returns the weight of a face. It is taken from the OS/2 table if
+// present, otherwise it is guessed from the subfamily name.
+//
+// Some fonts flag their bold face as bold while giving it a lighter weight
+// class (e.g., Go Bold has a weight class of 600). We honour the bold flag
+// in this case.
+func (fi FaceInfo) Weight() font.Weight {
+	if fi.hasOS2 && fi.WeightClass > 0 {
+		w := WeightFromClass(fi.WeightClass)
+		if fi.Bold && w < font.WeightBold {
+			w = font.WeightBold
+		}
+		return w
+	}
+	_, w := guessFromName(fi.PreferredSubfamily())
+	return w
+}
+
+// Stretch returns the width of a face. It is taken from the OS/2 table if
+// present, otherwise it is guessed from the face's names.
+func (fi FaceInfo) Stretch() Stretch {
+	if fi.hasOS2 && fi.WidthClass > 0 {
+		return StretchFromWidthClass(fi.WidthClass)
+	}
+	return StretchFromName(fi.PreferredFamily() + " " + fi.PreferredSubfamily())
+}
+
+// IsVariable returns true if a face is a variable font.
+func (fi FaceInfo) IsVariable() bool {
+	return len(fi.Axes) > 0
+}
+
+// CoversStyle returns true if a face has a given style or, for variable fonts,
+// is able to realize it by its ital or slnt axis.
+func (fi FaceInfo) CoversStyle(style font.Style) bool {
+	if fi.Style() == style {
+		return true
+	}
+	if style == font.StyleNormal {
+		return false
+	}
+	_, ital := findAxis(fi.Axes, AxisItalic)
+	_, slnt := findAxis(fi.Axes, AxisSlant)
+	return (style == font.StyleItalic && ital) || slnt
+}
+
+// CoversWeight returns true if a face has a given numeric weight (see
+// Descriptor.WeightValue) or, for variable fonts, the weight lies within the
+// range of its wght axis.
+func (fi FaceInfo) CoversWeight(weight float32) bool {
+	if a, ok := findAxis(fi.Axes, AxisWeight); ok {
+		return a.Covers(weight)
+	}
+	return fi.Weight() == WeightFromClass(int(math.Round(float64(weight))))
+}
+
+// CoversOpticalSize returns true if a face is designed for a given optical size
+// (in points). Faces without information about their optical size range are
+// assumed to cover every size.
+func (fi FaceInfo) CoversOpticalSize(size float32) bool {
+	if a, ok := findAxis(fi.Axes, AxisOpticalSize); ok && size > 0 {
+		return a.Covers(size)
+	}
+	if size <= 0 || fi.OpticalSizeMax <= 0 {
+		return true
+	}
+	return size >= fi.OpticalSizeMin && size < fi.OpticalSizeMax
+}
+
+// WeightFromClass converts a numeric weight (CSS font-weight or OS/2
+// usWeightClass, 1…1000) to the closest font.Weight.
+func WeightFromClass(wc int) font.Weight {
+	if wc > 0 && wc < 10 { // some legacy fonts use classes 1…9
+		wc *= 100
+	}
+	w := (wc + 50) / 100
+	w = min(max(w, 1), 9)
+	return font.Weight(w - 4)
+}
+
+// WeightClass converts a font.Weight to its numeric CSS font-weight value.
+func WeightClass(w font.Weight) int {
+	return (int(w) + 4) * 100
+}
+
+// ReadFaceInfo enumerates the faces contained in font data and reads their
+// metadata. data may either be a single font or a font collection.
+func ReadFaceInfo(data []byte) ([]FaceInfo, error) {
+	return ReadFaceInfoAt(bytes.NewReader(data))
+}
+
+// ReadFaceInfoAt is like ReadFaceInfo, but reads font data from r, e.g. an
+// open font file. Data is read on demand: the tables holding metadata (name,
+// OS/2 and fvar) and the parts of other tables package sfnt needs to parse a
+// face, but no glyph outlines.
+func ReadFaceInfoAt(r io.ReaderAt) ([]FaceInfo, error) {
+	c, err := sfnt.ParseCollectionReaderAt(r)
+	if err != nil {
+		return nil, err
+	}
+	faces := make([]FaceInfo, 0, c.NumFonts())
+	var buf sfnt.Buffer
+	for i := 0; i < c.NumFonts(); i++ {
+		f, err := c.Font(i)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse face %d: %w", i, err)
+		}
+		fi := FaceInfo{Index: i}
+		fi.Family, _ = f.Name(&buf, sfnt.NameIDFamily)
+		fi.Subfamily, _ = f.Name(&buf, sfnt.NameIDSubfamily)
+		fi.TypographicFamily, _ = f.Name(&buf, sfnt.NameIDTypographicFamily)
+		fi.TypographicSubfamily, _ = f.Name(&buf, sfnt.NameIDTypographicSubfamily)
+		if os2, err := sfntTableAt(r, i, "OS/2"); err == nil {
+			fi.readOS2(os2)
+		}
+		if fvar, err := sfntTableAt(r, i, "fvar"); err == nil {
+			fi.Axes, fi.Instances = readFvar(fvar, f, &buf)
+		}
+		faces = append(faces, fi)
+	}
+	return faces, nil
+}
+
+// readOS2 extracts weight, width and style information from an OS/2 table.
+func (fi *FaceInfo) readOS2(os2 []byte) {
+	if len(os2) < 64 { // need fsSelection at offset 62
+		return
+	}
+	be := binary.BigEndian
+	fi.WeightClass = int(be.Uint16(os2[4:]))
+	fi.WidthClass = int(be.Uint16(os2[6:]))
+	fsSelection := be.Uint16(os2[62:])
+	fi.Italic = fsSelection&0x0001 != 0
+	fi.Bold = fsSelection&0x0020 != 0
+	fi.Oblique = fsSelection&0x0200 != 0
+	fi.hasOS2 = true
+	// OS/2 version 5 adds the optical size range, in TWIPs (1/20 point)
+	if version := be.Uint16(os2); version >= 5 && len(os2) >= 100 {
+		fi.OpticalSizeMin = float32(be.Uint16(os2[96:])) / 20
+		fi.OpticalSizeMax = float32(be.Uint16(os2[98:])) / 20
+	}
+}
+
+// Metadata reads the metadata of the selected face of a scalable font.
+func (f *ScalableFont) Metadata() (FaceInfo, error) {
+	data, err := f.ReadFontData()
+	if err != nil {
+		return FaceInfo{}, err
+	}
+	faces, err := ReadFaceInfo(data)
+	if err != nil {
+		return FaceInfo{}, err
+	}
+	if f.index < 0 || f.index >= len(faces) {
+		return FaceInfo{}, errFaceIndex
+	}
+	return faces[f.index], nil
+}
+
+// SetMetadata sets family, style, weight and stretch of a scalable font from
+// the metadata of one of its faces, and selects this face within a collection.
+// For variable fonts, the font's axes and named instances are set as well,
+// with the default instance selected (see SelectInstance).
+func (f *ScalableFont) SetMetadata(fi FaceInfo) {
+	f.Family = fi.PreferredFamily()
+	f.Style = fi.Style()
+	f.Weight = fi.Weight()
+	f.Stretch = fi.Stretch()
+	f.index = fi.Index
+	f.variation = nil
+	if fi.IsVariable() {
+		f.variation = &Variation{Axes: fi.Axes, Instances: fi.Instances}
+	}
+}
+
+// MatchFace returns true if a face's family name contains pattern and the face
+// has a given style and weight (see CoversStyle and CoversWeight).
+func MatchFace(fi FaceInfo, pattern string, style font.Style, weight font.Weight) bool {
+	return fi.FamilyMatch(pattern) > 0 && fi.CoversStyle(style) &&
+		fi.CoversWeight(float32(WeightClass(weight)))
+}
+
+// FamilyMatch scores a face's family names against pattern: 2 for an exact
+// (case-insensitive) match, 1 if a family name contains pattern, 0 otherwise.
+// Both typographic and legacy family names are considered.
+func (fi FaceInfo) FamilyMatch(pattern string) int {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	score := 0
+	for _, fam := range []string{fi.TypographicFamily, fi.Family} {
+		if fam == "" {
+			continue
+		}
+		fam = strings.ToLower(fam)
+		if fam == pattern {
+			return 2
+		}
+		if strings.Contains(fam, pattern) {
+			score = 1
+		}
+	}
+	return score
+}
+
+// Properties returns the properties of a face as seen by the CSS font
+// matching algorithm (see FindClosestFace). Variable fonts able to realize
+// more than one style by their ital or slnt axis yield one entry per style.
+func (fi FaceInfo) Properties() []FaceProperties {
+	fp := StaticFace(fi.Style(), float32(WeightClass(fi.Weight())), fi.Stretch())
+	if a, ok := findAxis(fi.Axes, AxisWeight); ok {
+		fp.WeightMin, fp.WeightMax = a.Min, a.Max
+	}
+	if a, ok := findAxis(fi.Axes, AxisWidth); ok {
+		fp.StretchMin, fp.StretchMax = Stretch(a.Min), Stretch(a.Max)
+	}
+	props := []FaceProperties{fp}
+	for _, style := range []font.Style{font.StyleItalic, font.StyleOblique} {
+		if style != fp.Style && fi.CoversStyle(style) {
+			slanted := fp
+			slanted.Style = style
+			props = append(props, slanted)
+		}
+	}
+	return props
+}
+
+// MatchFaces returns the position of the face best matching a font descriptor
+// in faces, together with the match confidence. Faces with an exact family
+// name match (see FamilyMatch) are preferred over faces whose family name just
+// contains the pattern. Among those, the face closest to desc is selected by
+// the CSS font matching algorithm (see FindClosestFace), and faces designed
+// for the requested optical size are preferred.
+func MatchFaces(faces []FaceInfo, desc Descriptor) (int, MatchConfidence) {
+	var candidates []int // positions in faces
+	best := 0
+	for i, fi := range faces {
+		tracer().Debugf("face #%d = %s %s", fi.Index, fi.PreferredFamily(), fi.PreferredSubfamily())
+		score := fi.FamilyMatch(desc.Pattern)
+		if score == 0 || score < best {
+			continue
+		}
+		if score > best {
+			candidates, best = candidates[:0], score
+		}
+		candidates = append(candidates, i)
+	}
+	if len(candidates) == 0 {
+		return 0, NoConfidence
+	}
+	var props []FaceProperties
+	var owner []int // position in faces for each entry of props
+	for _, i := range candidates {
+		for _, fp := range faces[i].Properties() {
+			props, owner = append(props, fp), append(owner, i)
+		}
+	}
+	closest, confidence := closestFaces(props, desc)
+	pos := owner[closest[0]]
+	for _, j := range closest {
+		if faces[owner[j]].CoversOpticalSize(desc.OpticalSize) {
+			pos = owner[j]
+			break
+		}
+	}
+	return pos, min(confidence, familyConfidence(best))
+}
+
+// MatchFontFile checks if font data contains a face matching a font descriptor.
+// Matching is done on the metadata read from the font's tables. Only if the
+// font's tables cannot be read, MatchFontFile will resort to guessing from the
+// file name (see Matches).
+//
+// MatchFontFile returns the metadata of the best matching face and the match
+// confidence: PerfectConfidence for an exact family name match,
+// HighConfidence for a partial match or a face of different width and
+// NoConfidence for no match. If no face matches, the first face is returned.
+func MatchFontFile(data []byte, filename string, desc Descriptor) (FaceInfo, MatchConfidence) {
+	faces, err := ReadFaceInfo(data)
+	if err != nil || len(faces) == 0 {
+		tracer().Debugf("cannot read metadata of %s: %v", path.Base(filename), err)
+		fi := faceInfoFromFilename(filename)
+		if Matches(filename, desc.Pattern, desc.Style, desc.Weight) {
+			return fi, LowConfidence
+		}
+		return fi, NoConfidence
+	}
+	pos, confidence := MatchFaces(faces, desc)
+	return faces[pos], confidence
+}
+
+// familyConfidence converts a family match score (see FamilyMatch) for a
+// face with matching style and weight into a match confidence.
+func familyConfidence(score int) MatchConfidence {
+	switch score {
+	case 2:
+		return PerfectConfidence
+	case 1:
+		return HighConfidence
+	}
+	return NoConfidence
+}
+
+// faceInfoFromFilename guesses face metadata from a font's file name.
+func faceInfoFromFilename(filename string) FaceInfo {
+	base := path.Base(filename)
+	base = base[:len(base)-len(path.Ext(base))]
+	if family, sub, ok := strings.Cut(base, "-"); ok {
+		return FaceInfo{Family: family, Subfamily: sub}
+	}
+	return FaceInfo{Family: base, Subfamily: base}
+}
@@ -0,0 +1,107 @@
+package fontfind
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font"
+)
+
+func TestReadFaceInfo(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	data, err := os.ReadFile("locate/fallbackfont/packaged/Go-Bold-Italic.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces, err := ReadFaceInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("expected 1 face, got %d", len(faces))
+	}
+	fi := faces[0]
+	if fi.PreferredFamily() != "Go" || fi.PreferredSubfamily() != "Bold Italic" {
+		t.Errorf("unexpected names %q / %q", fi.PreferredFamily(), fi.PreferredSubfamily())
+	}
+	if fi.Style() != font.StyleItalic || fi.Weight() != font.WeightBold {
+		t.Errorf("expected bold italic, got style=%d weight=%d", fi.Style(), fi.Weight())
+	}
+}
+
+func TestReadFaceInfoAt(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	for _, name := range []string{"Go-Bold-Italic.otf", "GentiumPlus-R.ttf"} {
+		f, err := os.Open("locate/fallbackfont/packaged/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		info, _ := f.Stat()
+		r := &countingReaderAt{r: f}
+		faces, err := ReadFaceInfoAt(r)
+		if err != nil || len(faces) != 1 || faces[0].PreferredFamily() == "" || faces[0].WeightClass == 0 {
+			t.Fatalf("expected metadata of %s, got %+v (%v)", name, faces, err)
+		}
+		if r.n > info.Size()/4 {
+			t.Errorf("expected a fraction of %s to be read, got %d of %d bytes", name, r.n, info.Size())
+		}
+	}
+}
+
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestWeightClass(t *testing.T) {
+	for wc, w := range map[int]font.Weight{
+		100: font.WeightThin,
+		350: font.WeightNormal,
+		650: font.WeightBold,
+		7:   font.WeightBold,
+		950: font.WeightBlack,
+	} {
+		if WeightFromClass(wc) != w {
+			t.Errorf("expected weight class %d to be %d, is %d", wc, w, WeightFromClass(wc))
+		}
+	}
+	if WeightClass(font.WeightSemiBold) != 600 {
+		t.Errorf("expected semibold to have weight class 600")
+	}
+}
+
+func TestClosestStretch(t *testing.T) {
+	available := []Stretch{StretchCondensed, StretchNormal, StretchExpanded}
+	for _, c := range []struct {
+		requested, expected Stretch
+	}{
+		{0, StretchNormal},
+		{StretchSemiCondensed, StretchCondensed},
+		{StretchUltraCondensed, StretchCondensed},
+		{StretchSemiExpanded, StretchExpanded},
+		{StretchUltraExpanded, StretchExpanded},
+	} {
+		if s := ClosestStretch(available, c.requested); s != c.expected {
+			t.Errorf("requested stretch %v, expected %v, got %v", c.requested, c.expected, s)
+		}
+	}
+	if s := StretchFromName("Roboto Condensed"); s != StretchCondensed {
+		t.Errorf("expected Roboto Condensed to be condensed, is %v", s)
+	}
+	if s := StretchFromName("NotoSans-SemiCondensedBold"); s != StretchSemiCondensed {
+		t.Errorf("expected NotoSans-SemiCondensedBold to be semi-condensed, is %v", s)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Package observe provides instrumentation hooks for font resolution.
+
+The resolver pipeline (package locate), the font registry (package
+fontregistry) and the Google Fonts locator report events to an Observer:
+registry lookups, resolver calls with their duration and outcome, fallback
+substitutions and downloads. Stats is an observer collecting counters and
+latency histograms, which clients may scrape and export to their monitoring
+system.
+
+Observers are called synchronously by the goroutine emitting an event, and
+may be called concurrently. They should return quickly.
+
+# License
+
+Governed by a 3-Clause BSD license. License file may be found in the root
+folder of this module.
+*/
+package observe
+
+import (
+	"context"
+	"time"
+)
+
+// EventKind is the kind of an event.
+type EventKind int
+
+// Events reported by the resolver pipeline.
+const (
+	CacheHit       EventKind = iota + 1 // pipeline found the font in its registry
+	CacheMiss                           // pipeline did not find the font in its registry
+	KnownMiss                           // registry remembered a failed lookup (see locate.NegativeCache)
+	ResolverStart                       // resolver called
+	ResolverFinish                      // resolver returned, with Duration and Err
+	FallbackUsed                        // fallback font delivered
+)
+
+// Events reported by a font registry (fontregistry.Registry), for lookups of
+// any client.
+const (
+	RegistryHit        EventKind = iota + 101 // GetFont found a font
+	RegistryMiss                              // GetFont did not find a font
+	RegistryStore                             // StoreFont stored a font
+	RegistryEvict                             // font evicted from a bounded registry, with Bytes of font data freed
+	RegistryInvalidate                        // font dropped because its font file (Source) has changed
+)
+
+// Events reported by locators.
+const (
+	Download EventKind = iota + 201 // font file downloaded, with Bytes, Duration and Err
+)
+
+var kindNames = map[EventKind]string{
+	CacheHit:           "cache-hit",
+	CacheMiss:          "cache-miss",
+	KnownMiss:          "known-miss",
+	ResolverStart:      "resolver-start",
+	ResolverFinish:     "resolver-finish",
+	FallbackUsed:       "fallback-used",
+	RegistryHit:        "registry-hit",
+	RegistryMiss:       "registry-miss",
+	RegistryStore:      "registry-store",
+	RegistryEvict:      "registry-evict",
+	RegistryInvalidate: "registry-invalidate",
+	Download:           "download",
+}
+
+func (k EventKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Event is an observable step of font resolution. Fields not applicable to an
+// event kind are left empty.
+type Event struct {
+	Kind     EventKind
+	Key      string        // normalized registry key of the font request
+	Resolver string        // resolver name, for resolver events
+	Source   string        // font source, e.g. "google" or a download URL
+	Duration time.Duration // duration of a resolver call or download
+	Bytes    int64         // number of bytes downloaded
+	Err      error         // outcome of a resolver call or download
+}
+
+// Observer receives events.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// Multi returns an observer forwarding events to all the given observers.
+// Nil observers are skipped; if there are no others, Multi returns nil.
+func Multi(observers ...Observer) Observer {
+	var obs multi
+	for _, o := range observers {
+		if o != nil {
+			obs = append(obs, o)
+		}
+	}
+	if len(obs) == 0 {
+		return nil
+	}
+	return obs
+}
+
+type multi []Observer
+
+func (m multi) Observe(e Event) {
+	for _, o := range m {
+		o.Observe(e)
+	}
+}
+
+// Emit sends an event to an observer, if obs is not nil.
+func Emit(obs Observer, e Event) {
+	if obs != nil {
+		obs.Observe(e)
+	}
+}
+
+type observerKey struct{}
+
+// WithObserver returns a context carrying an observer. The resolver pipeline
+// hands its observer to resolvers this way, so that resolvers can report
+// events like downloads.
+func WithObserver(ctx context.Context, obs Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, obs)
+}
+
+// FromContext returns the observer carried by ctx, or nil.
+func FromContext(ctx context.Context) Observer {
+	if ctx == nil {
+		return nil
+	}
+	obs, _ := ctx.Value(observerKey{}).(Observer)
+	return obs
+}
@@ -0,0 +1,186 @@
+package observe
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBounds are the upper bounds of the latency histogram buckets
+// used by NewStats.
+var DefaultLatencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Stats is an observer collecting counters and latency histograms in memory.
+// It is safe for concurrent use.
+type Stats struct {
+	mu        sync.Mutex
+	bounds    []time.Duration
+	counts    map[EventKind]uint64
+	resolvers map[string]*resolverStats
+	downloads struct {
+		bytes   int64
+		errors  uint64
+		latency *Histogram
+	}
+}
+
+type resolverStats struct {
+	calls, failures uint64
+	latency         *Histogram
+}
+
+// NewStats creates a stats collector. Latencies are recorded in histograms
+// with buckets bounded by bounds, which must be sorted. If no bounds are
+// given, DefaultLatencyBounds are used.
+func NewStats(bounds ...time.Duration) *Stats {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBounds
+	}
+	s := &Stats{
+		bounds:    append([]time.Duration(nil), bounds...),
+		counts:    make(map[EventKind]uint64),
+		resolvers: make(map[string]*resolverStats),
+	}
+	s.downloads.latency = newHistogram(s.bounds)
+	return s
+}
+
+// Observe records an event.
+func (s *Stats) Observe(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[e.Kind]++
+	switch e.Kind {
+	case ResolverFinish:
+		rs, ok := s.resolvers[e.Resolver]
+		if !ok {
+			rs = &resolverStats{latency: newHistogram(s.bounds)}
+			s.resolvers[e.Resolver] = rs
+		}
+		rs.calls++
+		if e.Err != nil {
+			rs.failures++
+		}
+		rs.latency.observe(e.Duration)
+	case Download:
+		s.downloads.bytes += e.Bytes
+		if e.Err != nil {
+			s.downloads.errors++
+		}
+		s.downloads.latency.observe(e.Duration)
+	}
+}
+
+// Count returns the number of events of a kind recorded.
+func (s *Stats) Count(kind EventKind) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[kind]
+}
+
+// Reset clears all counters and histograms.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = make(map[EventKind]uint64)
+	s.resolvers = make(map[string]*resolverStats)
+	s.downloads.bytes, s.downloads.errors = 0, 0
+	s.downloads.latency = newHistogram(s.bounds)
+}
+
+// Snapshot is a copy of the statistics collected, suitable for export.
+type Snapshot struct {
+	Counts        map[EventKind]uint64     // number of events per kind
+	Resolvers     map[string]ResolverStats // statistics per resolver name
+	DownloadBytes int64                    // bytes downloaded
+	DownloadErrs  uint64                   // failed downloads
+	Downloads     Histogram                // download latencies
+}
+
+// ResolverStats are the statistics of a resolver.
+type ResolverStats struct {
+	Calls    uint64
+	Failures uint64
+	Latency  Histogram
+}
+
+// HitRate returns the share of pipeline lookups answered by the registry, or
+// 0 if there have been no lookups.
+func (snap Snapshot) HitRate() float64 {
+	hits, misses := snap.Counts[CacheHit], snap.Counts[CacheMiss]
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Snapshot returns a copy of the statistics collected so far.
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := Snapshot{
+		Counts:        make(map[EventKind]uint64, len(s.counts)),
+		Resolvers:     make(map[string]ResolverStats, len(s.resolvers)),
+		DownloadBytes: s.downloads.bytes,
+		DownloadErrs:  s.downloads.errors,
+		Downloads:     s.downloads.latency.copy(),
+	}
+	for k, n := range s.counts {
+		snap.Counts[k] = n
+	}
+	for name, rs := range s.resolvers {
+		snap.Resolvers[name] = ResolverStats{Calls: rs.calls, Failures: rs.failures, Latency: rs.latency.copy()}
+	}
+	return snap
+}
+
+// --- Histograms ------------------------------------------------------------
+
+// Histogram is a latency histogram. Counts[i] is the number of observations
+// less than or equal to Bounds[i] (and greater than Bounds[i-1]); the last
+// entry of Counts, which has no bound, counts observations greater than all
+// bounds.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64 // len(Bounds)+1 buckets
+	Count  uint64   // total number of observations
+	Sum    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *Histogram {
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h *Histogram) copy() Histogram {
+	c := *h
+	c.Bounds = append([]time.Duration(nil), h.Bounds...)
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return c
+}
+
+// Mean returns the mean of the observations, or 0 if there are none.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
@@ -0,0 +1,45 @@
+package observe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	stats := NewStats(10*time.Millisecond, 100*time.Millisecond)
+	obs := Multi(stats, nil)
+	obs.Observe(Event{Kind: CacheMiss, Key: "roboto"})
+	obs.Observe(Event{Kind: ResolverFinish, Resolver: "system", Duration: 5 * time.Millisecond, Err: errors.New("x")})
+	obs.Observe(Event{Kind: ResolverFinish, Resolver: "google", Duration: 50 * time.Millisecond})
+	obs.Observe(Event{Kind: CacheHit, Key: "roboto"})
+	obs.Observe(Event{Kind: CacheHit, Key: "roboto"})
+	obs.Observe(Event{Kind: CacheHit, Key: "roboto"})
+	obs.Observe(Event{Kind: Download, Bytes: 1000, Duration: time.Second})
+	snap := stats.Snapshot()
+	if snap.HitRate() != 0.75 {
+		t.Errorf("expected hit rate 0.75, got %v", snap.HitRate())
+	}
+	if rs := snap.Resolvers["system"]; rs.Calls != 1 || rs.Failures != 1 || rs.Latency.Counts[0] != 1 {
+		t.Errorf("unexpected stats for resolver system: %+v", rs)
+	}
+	if rs := snap.Resolvers["google"]; rs.Calls != 1 || rs.Failures != 0 || rs.Latency.Counts[1] != 1 {
+		t.Errorf("unexpected stats for resolver google: %+v", rs)
+	}
+	if snap.DownloadBytes != 1000 || snap.Downloads.Counts[2] != 1 || snap.Downloads.Mean() != time.Second {
+		t.Errorf("unexpected download stats: %d bytes, %+v", snap.DownloadBytes, snap.Downloads)
+	}
+	stats.Reset()
+	if stats.Count(CacheHit) != 0 || len(stats.Snapshot().Resolvers) != 0 {
+		t.Errorf("expected stats to be reset")
+	}
+}
+
+func TestMultiOfNilObservers(t *testing.T) {
+	if obs := Multi(nil, nil); obs != nil {
+		t.Errorf("expected Multi of nil observers to be nil, got %v", obs)
+	}
+	if obs := Multi(); obs != nil {
+		t.Errorf("expected Multi of no observers to be nil, got %v", obs)
+	}
+}
@@ -0,0 +1,542 @@
+package fontfind
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// Font descriptors are often given as strings in documents and configuration
+// files. We support two syntaxes:
+//
+// ▪︎ fontconfig patterns, e.g. "Noto Sans-12:style=Bold Italic", see
+// https://www.freedesktop.org/software/fontconfig/fontconfig-user.html#AEN36
+//
+// ▪︎ the CSS font shorthand, e.g. `italic 600 12pt "Source Serif 4", serif`, see
+// https://www.w3.org/TR/css-fonts-4/#font-prop
+//
+// The canonical string form of a descriptor (see Descriptor.String) is a
+// fontconfig pattern.
+
+// weightNames maps weight keywords to numeric weights (CSS font-weight). It
+// includes the weight constants of fontconfig as well as weight names common
+// in font names.
+var weightNames = map[string]float32{
+	"thin": 100, "hairline": 100,
+	"extralight": 200, "ultralight": 200,
+	"light":     300,
+	"demilight": 350, "semilight": 350,
+	"book":    380,
+	"regular": 400, "normal": 400,
+	"medium":   500,
+	"semibold": 600, "demibold": 600,
+	"bold":      700,
+	"extrabold": 800, "ultrabold": 800,
+	"black": 900, "heavy": 900,
+	"extrablack": 1000, "ultrablack": 1000,
+}
+
+// weightKeywords holds the canonical keyword for each font.Weight, starting
+// with font.WeightThin.
+var weightKeywords = [...]string{
+	"thin", "extralight", "light", "regular", "medium",
+	"semibold", "bold", "extrabold", "black",
+}
+
+// weightKeyword returns the canonical keyword for a weight.
+func weightKeyword(w font.Weight) string {
+	i := int(w - font.WeightThin)
+	if i < 0 || i >= len(weightKeywords) {
+		return strconv.Itoa(WeightClass(w))
+	}
+	return weightKeywords[i]
+}
+
+// lookupWeightName looks up a weight keyword, ignoring case, blanks and
+// hyphens (e.g., "Semi-Bold").
+func lookupWeightName(name string) (float32, bool) {
+	name = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+	w, ok := weightNames[name]
+	return w, ok
+}
+
+// setWeight sets the weight of a descriptor from a numeric weight. Weights in
+// between the font.Weight constants are set as value of the wght axis.
+func (d *Descriptor) setWeight(w float32) {
+	d.Weight = WeightFromClass(int(math.Round(float64(w))))
+	if float32(WeightClass(d.Weight)) != w {
+		d.setVariation(AxisWeight, w)
+	}
+}
+
+func (d *Descriptor) setVariation(tag string, v float32) {
+	if d.Variations == nil {
+		d.Variations = make(map[string]float32)
+	}
+	d.Variations[tag] = v
+}
+
+// --- fontconfig patterns ---------------------------------------------------
+
+// fcWeights maps fontconfig weights to numeric weights (CSS font-weight),
+// following fontconfig's FcWeightToOpenType. Weights in between are
+// interpolated linearly.
+var fcWeights = [...]struct{ fc, css float32 }{
+	{0, 100}, {40, 200}, {50, 300}, {55, 350}, {75, 380}, {80, 400},
+	{100, 500}, {180, 600}, {200, 700}, {205, 800}, {210, 900}, {215, 1000},
+}
+
+// weightFromFontconfig converts a fontconfig weight to a numeric weight.
+func weightFromFontconfig(fc float32) float32 {
+	if fc <= fcWeights[0].fc {
+		return fcWeights[0].css
+	}
+	for i := 1; i < len(fcWeights); i++ {
+		lo, hi := fcWeights[i-1], fcWeights[i]
+		if fc <= hi.fc {
+			w := lo.css + (fc-lo.fc)*(hi.css-lo.css)/(hi.fc-lo.fc)
+			return float32(math.Round(float64(w)))
+		}
+	}
+	return fcWeights[len(fcWeights)-1].css
+}
+
+// fcSlants maps fontconfig slant values to styles.
+var fcSlants = map[string]font.Style{
+	"roman": font.StyleNormal, "0": font.StyleNormal,
+	"italic": font.StyleItalic, "100": font.StyleItalic,
+	"oblique": font.StyleOblique, "110": font.StyleOblique,
+}
+
+// ParseFontconfig parses a fontconfig pattern into a font descriptor, e.g.
+//
+//	Noto Sans-12:style=Bold Italic
+//	Noto Sans:weight=200:slant=italic:width=semicondensed
+//	Roboto Flex:fontvariations=wght=650,GRAD=-25,opsz=14
+//
+// Numeric weights are interpreted on fontconfig's scale (e.g., 200 is bold).
+// Properties "family", "size", "style", "weight", "slant", "width" and
+// "fontvariations" are recognized, as well as constants like ":bold" or
+// ":italic". Other properties are ignored. Explicit values for weight, slant
+// and width take precedence over values implied by "style". A list of
+// families is parsed into a font stack (see Descriptor.Families), only the
+// first of a list of sizes is used. The "opsz" variation axis is
+// parsed into the descriptor's optical size. Syntax errors are reported as
+// *PatternError.
+func ParseFontconfig(pattern string) (Descriptor, error) {
+	var d Descriptor
+	parts := splitEscaped(pattern, ':')
+	familyAndSize := splitEscaped(parts[0], '-')
+	d.setFamilies(splitEscaped(familyAndSize[0], ','))
+	if len(familyAndSize) > 1 {
+		size, err := parseFCNumber(splitEscaped(familyAndSize[1], ',')[0])
+		if err != nil {
+			return Descriptor{}, &PatternError{Pattern: pattern, Err: fmt.Errorf("size: %w", err)}
+		}
+		d.Size = size
+	}
+	var styleName string
+	var hasWeight, hasSlant, hasWidth bool
+	for _, prop := range parts[1:] {
+		prop = strings.TrimSpace(prop)
+		if prop == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(prop, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok { // constant
+			switch w, isWeight := lookupWeightName(name); {
+			case isWeight:
+				d.setWeight(w)
+				hasWeight = true
+			case fcSlants[name] != font.StyleNormal || name == "roman":
+				d.Style, hasSlant = fcSlants[name], true
+			default:
+				s, isWidth := StretchFromKeyword(fcWidthKeyword(name))
+				if !isWidth {
+					return Descriptor{}, &PatternError{Pattern: pattern, Err: fmt.Errorf("unknown constant %q", name)}
+				}
+				d.Stretch, hasWidth = stretchOrZero(s), true
+			}
+			continue
+		}
+		if name == "family" {
+			d.setFamilies(splitEscaped(value, ','))
+			continue
+		}
+		if name == "fontvariations" {
+			if err := d.parseFCVariations(value); err != nil {
+				return Descriptor{}, &PatternError{Pattern: pattern, Err: err}
+			}
+			continue
+		}
+		value = strings.TrimSpace(unescapeFC(splitEscaped(value, ',')[0]))
+		var err error
+		switch name {
+		case "size":
+			d.Size, err = parseFCNumber(value)
+		case "style":
+			styleName = value
+		case "weight":
+			if w, ok := lookupWeightName(value); ok {
+				d.setWeight(w)
+			} else if fc, e := parseFCNumber(value); e == nil {
+				d.setWeight(weightFromFontconfig(fc))
+			} else {
+				err = fmt.Errorf("weight: %q", value)
+			}
+			hasWeight = true
+		case "slant":
+			style, ok := fcSlants[strings.ToLower(value)]
+			if !ok {
+				err = fmt.Errorf("slant: %q", value)
+			}
+			d.Style, hasSlant = style, true
+		case "width":
+			if s, ok := StretchFromKeyword(fcWidthKeyword(value)); ok {
+				d.Stretch = stretchOrZero(s)
+			} else if v, e := parseFCNumber(value); e == nil {
+				d.Stretch = stretchOrZero(Stretch(v))
+			} else {
+				err = fmt.Errorf("width: %q", value)
+			}
+			hasWidth = true
+		}
+		if err != nil {
+			return Descriptor{}, &PatternError{Pattern: pattern, Err: err}
+		}
+	}
+	if styleName != "" {
+		style, weight := guessFromName(styleName)
+		if !hasSlant {
+			d.Style = style
+		}
+		if !hasWeight {
+			d.Weight = weight
+		}
+		if !hasWidth {
+			d.Stretch = stretchOrZero(StretchFromName(styleName))
+		}
+	}
+	return d, nil
+}
+
+// setFamilies sets the family of a descriptor from a list of escaped family
+// names. More than one family make a font stack.
+func (d *Descriptor) setFamilies(families []string) {
+	d.Families = nil
+	for _, f := range families {
+		if f = strings.TrimSpace(unescapeFC(f)); f != "" {
+			d.Families = append(d.Families, f)
+		}
+	}
+	d.Pattern = ""
+	if len(d.Families) > 0 {
+		d.Pattern = d.Families[0]
+	}
+	if len(d.Families) < 2 {
+		d.Families = nil
+	}
+}
+
+// parseFCVariations parses a list of variation axis values, e.g.
+// "wght=650,GRAD=-25".
+func (d *Descriptor) parseFCVariations(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		tag, num, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if !ok || len(tag) != 4 {
+			return fmt.Errorf("fontvariations: %q", v)
+		}
+		f, err := parseFCNumber(num)
+		if err != nil {
+			return fmt.Errorf("fontvariations: %q", v)
+		}
+		if tag == AxisOpticalSize {
+			d.OpticalSize = f
+			continue
+		}
+		d.setVariation(tag, f)
+	}
+	return nil
+}
+
+// fcWidthKeyword converts a fontconfig width constant (e.g. "semicondensed")
+// to the corresponding CSS keyword ("semi-condensed").
+func fcWidthKeyword(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, prefix := range []string{"ultra", "extra", "semi"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && !strings.HasPrefix(rest, "-") {
+			return prefix + "-" + rest
+		}
+	}
+	return name
+}
+
+// stretchOrZero returns 0 for normal width, in line with the zero value of
+// Descriptor.
+func stretchOrZero(s Stretch) Stretch {
+	if s.IsNormal() {
+		return 0
+	}
+	return s
+}
+
+func parseFCNumber(s string) (float32, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 32)
+	return float32(f), err
+}
+
+// splitEscaped splits s at every occurrence of sep not preceded by a backslash.
+// Escapes are left in place.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeFC(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+var fcEscaper = strings.NewReplacer(`\`, `\\`, `-`, `\-`, `:`, `\:`, `,`, `\,`)
+
+// String returns the canonical string form of a descriptor, which is a
+// fontconfig pattern (see ParseFontconfig), e.g.
+//
+//	Noto Sans-12:slant=italic:weight=semibold:width=condensed
+//
+// Parsing the result with ParseFontconfig yields the descriptor again.
+func (d Descriptor) String() string {
+	var b strings.Builder
+	for i, f := range d.FamilyStack() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(fcEscaper.Replace(f))
+	}
+	if d.Size > 0 {
+		b.WriteString("-" + formatNumber(d.Size))
+	}
+	switch d.Style {
+	case font.StyleItalic:
+		b.WriteString(":slant=italic")
+	case font.StyleOblique:
+		b.WriteString(":slant=oblique")
+	}
+	if d.Weight != font.WeightNormal {
+		b.WriteString(":weight=" + weightKeyword(d.Weight))
+	}
+	if !d.Stretch.IsNormal() {
+		if kw := d.Stretch.Keyword(); kw != "" {
+			b.WriteString(":width=" + strings.ReplaceAll(kw, "-", ""))
+		} else {
+			b.WriteString(":width=" + formatNumber(float32(d.Stretch)))
+		}
+	}
+	vars := make([]string, 0, len(d.Variations)+1)
+	for tag, v := range d.Variations {
+		vars = append(vars, tag+"="+formatNumber(v))
+	}
+	if d.OpticalSize > 0 {
+		vars = append(vars, AxisOpticalSize+"="+formatNumber(d.OpticalSize))
+	}
+	if len(vars) > 0 {
+		sort.Strings(vars)
+		b.WriteString(":fontvariations=" + strings.Join(vars, ","))
+	}
+	return b.String()
+}
+
+func formatNumber(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+// MarshalText encodes a descriptor in its canonical string form (see String).
+// This makes descriptors usable in JSON and other text-based formats.
+func (d Descriptor) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a descriptor from a fontconfig pattern (see
+// ParseFontconfig).
+func (d *Descriptor) UnmarshalText(text []byte) error {
+	desc, err := ParseFontconfig(string(text))
+	if err != nil {
+		return err
+	}
+	*d = desc
+	return nil
+}
+
+// --- CSS font shorthand ----------------------------------------------------
+
+// cssSizeUnits maps absolute CSS length units to points.
+var cssSizeUnits = map[string]float32{
+	"pt": 1, "px": 0.75, "pc": 12, "in": 72, "cm": 72 / 2.54, "mm": 72 / 25.4, "q": 72 / 101.6,
+}
+
+// cssSizeKeywords maps absolute CSS font-size keywords to points.
+var cssSizeKeywords = map[string]float32{
+	"xx-small": 6.75, "x-small": 7.5, "small": 9.75, "medium": 12,
+	"large": 13.5, "x-large": 18, "xx-large": 24, "xxx-large": 36,
+}
+
+// ParseCSSFont parses the CSS font shorthand into a font descriptor, e.g.
+//
+//	italic 600 12pt "Source Serif 4", serif
+//	condensed bold 16px/1.2 Roboto
+//
+// Style, weight and stretch are optional and may appear in any order before
+// the mandatory font size, which has to be given as an absolute length or
+// keyword. The font size is followed by an optional line height, which is
+// ignored, and the mandatory list of font families. A list of more than one
+// family is parsed into a font stack (see Descriptor.Families). Besides CSS keywords, weight keywords like "semibold" or
+// "black" are accepted. An oblique angle (e.g. "oblique 10deg") is set as
+// value of the slnt axis. Syntax errors are reported as *PatternError.
+func ParseCSSFont(shorthand string) (Descriptor, error) {
+	var d Descriptor
+	tokens, err := cssTokens(shorthand)
+	if err != nil {
+		return Descriptor{}, &PatternError{Pattern: shorthand, Err: err}
+	}
+	i, sized := 0, false
+	for ; i < len(tokens) && !sized; i++ {
+		tok := strings.ToLower(tokens[i])
+		switch {
+		case tok == "normal" || tok == "small-caps":
+			// nothing to set
+		case tok == "italic":
+			d.Style = font.StyleItalic
+		case tok == "oblique":
+			d.Style = font.StyleOblique
+			if i+1 < len(tokens) {
+				if deg, ok := strings.CutSuffix(strings.ToLower(tokens[i+1]), "deg"); ok {
+					angle, err := parseFCNumber(deg)
+					if err != nil {
+						return Descriptor{}, &PatternError{Pattern: shorthand, Err: fmt.Errorf("oblique angle %q", tokens[i+1])}
+					}
+					d.setVariation(AxisSlant, -angle)
+					i++
+				}
+			}
+		case tok == "bolder":
+			d.setWeight(700)
+		case tok == "lighter":
+			d.setWeight(100)
+		default:
+			if size, ok := cssSizeKeywords[tok]; ok { // "medium" is a size here
+				d.Size, sized = size, true
+			} else if w, ok := lookupWeightName(tok); ok {
+				d.setWeight(w)
+			} else if s, ok := StretchFromKeyword(tok); ok {
+				d.Stretch = stretchOrZero(s)
+			} else if w, err := strconv.ParseFloat(tok, 32); err == nil && w >= 1 && w <= 1000 {
+				d.setWeight(float32(w))
+			} else {
+				size, err := parseCSSSize(tok)
+				if err != nil {
+					return Descriptor{}, &PatternError{Pattern: shorthand, Err: err}
+				}
+				d.Size, sized = size, true
+			}
+		}
+	}
+	if !sized {
+		return Descriptor{}, &PatternError{Pattern: shorthand, Err: errors.New("missing font size")}
+	}
+	if i < len(tokens) && tokens[i] == "/" { // skip line height
+		i += 2
+	}
+	var families []string
+	for {
+		var family []string
+		for ; i < len(tokens) && tokens[i] != ","; i++ {
+			family = append(family, strings.Trim(tokens[i], `"'`))
+		}
+		if len(family) == 0 {
+			return Descriptor{}, &PatternError{Pattern: shorthand, Err: errors.New("missing font family")}
+		}
+		families = append(families, strings.Join(family, " "))
+		if i == len(tokens) {
+			break
+		}
+		i++ // skip comma
+	}
+	d.Pattern = families[0]
+	if len(families) > 1 {
+		d.Families = families
+	}
+	return d, nil
+}
+
+// cssTokens splits a CSS font shorthand into tokens, separated by blanks.
+// Quoted strings, commas and slashes form tokens of their own.
+func cssTokens(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == ',' || c == '/':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		default:
+			end := strings.IndexAny(s[i:], " \t\n,/")
+			if end < 0 {
+				end = len(s) - i
+			}
+			tokens = append(tokens, s[i:i+end])
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// parseCSSSize converts a CSS font size to points. Relative sizes (e.g., "em"
+// or percentages) cannot be converted and result in an error.
+func parseCSSSize(tok string) (float32, error) {
+	if size, ok := cssSizeKeywords[tok]; ok {
+		return size, nil
+	}
+	num := strings.TrimRight(tok, "abcdefghijklmnopqrstuvwxyz%")
+	factor, ok := cssSizeUnits[tok[len(num):]]
+	if !ok {
+		return 0, fmt.Errorf("unsupported font size %q", tok)
+	}
+	f, err := strconv.ParseFloat(num, 32)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("unsupported font size %q", tok)
+	}
+	return float32(f) * factor, nil
+}
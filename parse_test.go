@@ -0,0 +1,103 @@
+package fontfind
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font"
+)
+
+func TestParseFontconfig(t *testing.T) {
+	for _, c := range []struct {
+		pattern  string
+		expected Descriptor
+	}{
+		{"Noto Sans:style=Bold Italic:weight=200", Descriptor{Pattern: "Noto Sans",
+			Style: font.StyleItalic, Weight: font.WeightBold}},
+		{"Noto Sans-12:style=SemiCondensed Light", Descriptor{Pattern: "Noto Sans",
+			Weight: font.WeightLight, Stretch: StretchSemiCondensed, Size: 12}},
+		{"Roboto:weight=190:slant=oblique", Descriptor{Pattern: "Roboto", Style: font.StyleOblique,
+			Weight: font.WeightBold, Variations: map[string]float32{AxisWeight: 650}}},
+		{`Foo\-Bar,Baz:bold:italic:condensed`, Descriptor{Pattern: "Foo-Bar", Families: []string{"Foo-Bar", "Baz"},
+			Style: font.StyleItalic, Weight: font.WeightBold, Stretch: StretchCondensed}},
+		{"Roboto Flex:fontvariations=GRAD=-25,opsz=14", Descriptor{Pattern: "Roboto Flex",
+			OpticalSize: 14, Variations: map[string]float32{"GRAD": -25}}},
+	} {
+		d, err := ParseFontconfig(c.pattern)
+		if err != nil {
+			t.Errorf("cannot parse %q: %v", c.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(d, c.expected) {
+			t.Errorf("parsing %q: expected %+v, got %+v", c.pattern, c.expected, d)
+		}
+	}
+	if _, err := ParseFontconfig("Noto Sans:weight=heavyish"); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expected invalid weight to be rejected as invalid pattern, got %v", err)
+	}
+}
+
+func TestParseCSSFont(t *testing.T) {
+	for _, c := range []struct {
+		shorthand string
+		expected  Descriptor
+	}{
+		{`italic 600 12pt "Source Serif 4", serif`, Descriptor{Pattern: "Source Serif 4",
+			Families: []string{"Source Serif 4", "serif"}, Style: font.StyleItalic, Weight: font.WeightSemiBold, Size: 12}},
+		{`condensed black 16px/1.2 Noto Sans`, Descriptor{Pattern: "Noto Sans",
+			Weight: font.WeightBlack, Stretch: StretchCondensed, Size: 12}},
+		{`oblique 10deg semibold medium Roboto`, Descriptor{Pattern: "Roboto", Style: font.StyleOblique,
+			Weight: font.WeightSemiBold, Size: 12, Variations: map[string]float32{AxisSlant: -10}}},
+		{`650 1in 'Inter'`, Descriptor{Pattern: "Inter", Weight: font.WeightBold, Size: 72,
+			Variations: map[string]float32{AxisWeight: 650}}},
+	} {
+		d, err := ParseCSSFont(c.shorthand)
+		if err != nil {
+			t.Errorf("cannot parse %q: %v", c.shorthand, err)
+			continue
+		}
+		if !reflect.DeepEqual(d, c.expected) {
+			t.Errorf("parsing %q: expected %+v, got %+v", c.shorthand, c.expected, d)
+		}
+	}
+	for _, invalid := range []string{"bold Arial", "12pt", "italic 2em serif", "12pt Arial,"} {
+		var patternErr *PatternError
+		if _, err := ParseCSSFont(invalid); !errors.As(err, &patternErr) || patternErr.Pattern != invalid {
+			t.Errorf("expected %q to be rejected with a pattern error, got %v", invalid, err)
+		}
+	}
+}
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	desc := Descriptor{
+		Pattern:     "Roboto:Flex",
+		Style:       font.StyleItalic,
+		Weight:      font.WeightBold,
+		Stretch:     Stretch(90),
+		OpticalSize: 14,
+		Variations:  map[string]float32{AxisWeight: 650, "GRAD": -25},
+		Size:        10.5,
+	}
+	s := desc.String()
+	if s != `Roboto\:Flex-10.5:slant=italic:weight=bold:width=90:fontvariations=GRAD=-25,opsz=14,wght=650` {
+		t.Errorf("unexpected canonical form %s", s)
+	}
+	d, err := ParseFontconfig(s)
+	if err != nil || !reflect.DeepEqual(d, desc) {
+		t.Errorf("expected %s to round-trip, got %+v (%v)", s, d, err)
+	}
+	j, err := json.Marshal(map[string]Descriptor{"font": desc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]Descriptor
+	if err := json.Unmarshal(j, &m); err != nil || !reflect.DeepEqual(m["font"], desc) {
+		t.Errorf("expected descriptor to survive JSON round trip, got %+v (%v)", m["font"], err)
+	}
+	stack := FontStack("Source Serif 4", "Noto Serif", "serif")
+	if d, err := ParseFontconfig(stack.String()); err != nil || !reflect.DeepEqual(d, stack) {
+		t.Errorf("expected font stack %s to round-trip, got %+v (%v)", stack, d, err)
+	}
+}
@@ -0,0 +1,95 @@
+package fontfind
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Package sfnt of golang.org/x/image does not expose every table we are
+// interested in. The helpers in this file locate raw table data for a face
+// of a font file or font collection. See
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff#table-directory
+
+var errTableNotFound = errors.New("font table not found")
+
+var errFaceIndex = errors.New("face index out of range")
+
+// faceOffset returns the offset of the table directory of face number index
+// of font data read from r.
+func faceOffset(r io.ReaderAt, index int) (int64, error) {
+	var header [12]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return 0, errCorruptCollection
+	}
+	if binary.BigEndian.Uint32(header[:]) != ttcTag {
+		if index != 0 {
+			return 0, errFaceIndex
+		}
+		return 0, nil
+	}
+	numFonts := int(binary.BigEndian.Uint32(header[8:]))
+	if index < 0 || index >= numFonts {
+		return 0, errFaceIndex
+	}
+	var offset [4]byte
+	if _, err := r.ReadAt(offset[:], 12+4*int64(index)); err != nil {
+		return 0, errCorruptCollection
+	}
+	return int64(binary.BigEndian.Uint32(offset[:])), nil
+}
+
+// tableRecord looks up table tag (e.g., "OS/2") in the table directory of face
+// number index of font data read from r, and returns the offset and length of
+// the table. If the face does not contain the table, errTableNotFound is
+// returned.
+func tableRecord(r io.ReaderAt, index int, tag string) (int64, int64, error) {
+	offset, err := faceOffset(r, index)
+	if err != nil {
+		return 0, 0, err
+	}
+	be := binary.BigEndian
+	var header [12]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return 0, 0, errCorruptCollection
+	}
+	dir := make([]byte, 16*int(be.Uint16(header[4:])))
+	if _, err := r.ReadAt(dir, offset+12); err != nil {
+		return 0, 0, errCorruptCollection
+	}
+	for ; len(dir) >= 16; dir = dir[16:] {
+		if string(dir[:4]) == tag {
+			return int64(be.Uint32(dir[8:])), int64(be.Uint32(dir[12:])), nil
+		}
+	}
+	return 0, 0, errTableNotFound
+}
+
+// sfntTable returns the raw data of table tag (e.g., "OS/2") for face number
+// index of font data. If the face does not contain the table, errTableNotFound
+// is returned.
+func sfntTable(data []byte, index int, tag string) ([]byte, error) {
+	start, length, err := tableRecord(bytes.NewReader(data), index, tag)
+	if err != nil {
+		return nil, err
+	}
+	if start+length > int64(len(data)) {
+		return nil, errCorruptCollection
+	}
+	return data[start : start+length], nil
+}
+
+// sfntTableAt is like sfntTable, but reads nothing but the table directory and
+// the table from r.
+func sfntTableAt(r io.ReaderAt, index int, tag string) ([]byte, error) {
+	start, length, err := tableRecord(r, index, tag)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]byte, length)
+	if _, err := r.ReadAt(table, start); err != nil {
+		return nil, errCorruptCollection
+	}
+	return table, nil
+}
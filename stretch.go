@@ -0,0 +1,162 @@
+package fontfind
+
+import (
+	"math"
+	"strings"
+)
+
+// Stretch is the width of a font, expressed in percent of the normal width
+// of its family, following the semantics of CSS font-stretch
+// (https://www.w3.org/TR/css-fonts-4/#font-stretch-prop).
+//
+// The zero value is interpreted as StretchNormal.
+type Stretch float32
+
+const (
+	StretchUltraCondensed Stretch = 50
+	StretchExtraCondensed Stretch = 62.5
+	StretchCondensed      Stretch = 75
+	StretchSemiCondensed  Stretch = 87.5
+	StretchNormal         Stretch = 100
+	StretchSemiExpanded   Stretch = 112.5
+	StretchExpanded       Stretch = 125
+	StretchExtraExpanded  Stretch = 150
+	StretchUltraExpanded  Stretch = 200
+)
+
+// widthClasses maps OS/2 usWidthClass values 1…9 to stretch values.
+var widthClasses = [...]Stretch{
+	StretchUltraCondensed, StretchExtraCondensed, StretchCondensed,
+	StretchSemiCondensed, StretchNormal, StretchSemiExpanded,
+	StretchExpanded, StretchExtraExpanded, StretchUltraExpanded,
+}
+
+// stretchNames holds the CSS keywords for stretch values, ordered as
+// widthClasses.
+var stretchNames = [...]string{
+	"ultra-condensed", "extra-condensed", "condensed",
+	"semi-condensed", "normal", "semi-expanded",
+	"expanded", "extra-expanded", "ultra-expanded",
+}
+
+// Normalized returns StretchNormal for the zero value, and s otherwise.
+func (s Stretch) Normalized() Stretch {
+	if s <= 0 {
+		return StretchNormal
+	}
+	return s
+}
+
+// IsNormal returns true if s denotes the normal width of a font.
+func (s Stretch) IsNormal() bool {
+	return s.Normalized() == StretchNormal
+}
+
+// Keyword returns the CSS keyword for s (e.g., "semi-condensed"), or an
+// empty string if s does not correspond to a keyword.
+func (s Stretch) Keyword() string {
+	for i, w := range widthClasses {
+		if w == s.Normalized() {
+			return stretchNames[i]
+		}
+	}
+	return ""
+}
+
+// WidthClass returns the OS/2 usWidthClass (1…9) closest to s.
+func (s Stretch) WidthClass() int {
+	s = s.Normalized()
+	best, dist := 5, math.MaxFloat64
+	for i, w := range widthClasses {
+		if d := math.Abs(float64(w - s)); d < dist {
+			best, dist = i+1, d
+		}
+	}
+	return best
+}
+
+// StretchFromWidthClass converts an OS/2 usWidthClass value (1…9) to a
+// stretch value. Values out of range yield StretchNormal.
+func StretchFromWidthClass(wc int) Stretch {
+	if wc < 1 || wc > len(widthClasses) {
+		return StretchNormal
+	}
+	return widthClasses[wc-1]
+}
+
+// StretchFromKeyword converts a CSS font-stretch keyword to a stretch value.
+func StretchFromKeyword(keyword string) (Stretch, bool) {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	for i, n := range stretchNames {
+		if n == keyword {
+			return widthClasses[i], true
+		}
+	}
+	return StretchNormal, false
+}
+
+// StretchFromName guesses the stretch of a font from a family, subfamily or
+// file name, e.g. "Roboto Condensed" or "NotoSans-SemiCondensedBold".
+func StretchFromName(name string) Stretch {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name)
+	switch {
+	case strings.Contains(name, "ultracondensed"):
+		return StretchUltraCondensed
+	case strings.Contains(name, "extracondensed"):
+		return StretchExtraCondensed
+	case strings.Contains(name, "semicondensed"):
+		return StretchSemiCondensed
+	case strings.Contains(name, "condensed"), strings.Contains(name, "narrow"),
+		strings.Contains(name, "compressed"):
+		return StretchCondensed
+	case strings.Contains(name, "ultraexpanded"):
+		return StretchUltraExpanded
+	case strings.Contains(name, "extraexpanded"):
+		return StretchExtraExpanded
+	case strings.Contains(name, "semiexpanded"):
+		return StretchSemiExpanded
+	case strings.Contains(name, "expanded"), strings.Contains(name, "extended"),
+		strings.Contains(name, "wide"):
+		return StretchExpanded
+	}
+	return StretchNormal
+}
+
+// ClosestStretch selects from a set of available stretch values the one to
+// use for a requested stretch, following the CSS font matching rules: for
+// requests of normal width or narrower, narrower values are checked first
+// (closest first), then wider ones. For requests wider than normal, wider
+// values are checked first.
+//
+// If available is empty, ClosestStretch returns the requested stretch.
+func ClosestStretch(available []Stretch, requested Stretch) Stretch {
+	requested = requested.Normalized()
+	if len(available) == 0 {
+		return requested
+	}
+	var below, above Stretch // closest values on either side
+	var haveBelow, haveAbove bool
+	for _, s := range available {
+		s = s.Normalized()
+		if s == requested {
+			return s
+		}
+		if s < requested && (!haveBelow || s > below) {
+			below, haveBelow = s, true
+		}
+		if s > requested && (!haveAbove || s < above) {
+			above, haveAbove = s, true
+		}
+	}
+	if requested <= StretchNormal {
+		if haveBelow {
+			return below
+		}
+		return above
+	}
+	if haveAbove {
+		return above
+	}
+	return below
+}
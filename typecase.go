@@ -0,0 +1,186 @@
+package fontfind
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
+)
+
+// Typecase is a scaled font, i.e. a scalable font in a certain point size,
+// for an output resolution, a script and a language (see package
+// documentation).
+//
+// A typecase parses its font's data only once. Typecases derived from it by
+// WithSize share the parsed font. Please note that the font.Face returned by
+// Face is not safe for concurrent use.
+//
+// Axis coordinates of variable fonts (see ScalableFont.Coordinates) are not
+// applied by the rasterizer of golang.org/x/image, i.e. faces of variable
+// fonts are rendered in their default instance.
+type Typecase struct {
+	scalableFont ScalableFont
+	size         float32 // in printer's points
+	dpi          float32
+	script       language.Script
+	lang         language.Tag
+	parsed       *parsedFont // shared between typecases of the same font
+	faceMutex    sync.Mutex  // guards face and faceErr
+	face         font.Face
+	faceErr      error
+}
+
+// parsedFont holds the parsed data of a scalable font.
+type parsedFont struct {
+	once sync.Once
+	sfnt *sfnt.Font
+	err  error
+}
+
+// NewTypecase creates a typecase for a scalable font at a given point size
+// and resolution (dpi). If script is the zero value, it is derived from lang.
+//
+// Font data is read and parsed on first use, not by NewTypecase.
+func NewTypecase(sf ScalableFont, ptSize, dpi float32, script language.Script, lang language.Tag) (*Typecase, error) {
+	if ptSize <= 0 {
+		return nil, errors.New("typecase: font size must be positive")
+	}
+	if dpi <= 0 {
+		return nil, errors.New("typecase: resolution must be positive")
+	}
+	if script == (language.Script{}) {
+		script, _ = lang.Script()
+	}
+	return &Typecase{
+		scalableFont: sf,
+		size:         ptSize,
+		dpi:          dpi,
+		script:       script,
+		lang:         lang,
+		parsed:       &parsedFont{},
+	}, nil
+}
+
+// WithSize returns a typecase of the same font, script and language in a
+// different point size. The new typecase shares the parsed font with tc.
+func (tc *Typecase) WithSize(ptSize float32) (*Typecase, error) {
+	if ptSize <= 0 {
+		return nil, errors.New("typecase: font size must be positive")
+	}
+	return &Typecase{
+		scalableFont: tc.scalableFont,
+		size:         ptSize,
+		dpi:          tc.dpi,
+		script:       tc.script,
+		lang:         tc.lang,
+		parsed:       tc.parsed,
+	}, nil
+}
+
+// ScalableFont returns the scalable font of a typecase.
+func (tc *Typecase) ScalableFont() ScalableFont {
+	return tc.scalableFont
+}
+
+// Size returns the size of a typecase in printer's points.
+func (tc *Typecase) Size() float32 {
+	return tc.size
+}
+
+// DPI returns the output resolution of a typecase.
+func (tc *Typecase) DPI() float32 {
+	return tc.dpi
+}
+
+// Script returns the script a typecase is used for.
+func (tc *Typecase) Script() language.Script {
+	return tc.script
+}
+
+// Language returns the language a typecase is used for.
+func (tc *Typecase) Language() language.Tag {
+	return tc.lang
+}
+
+// SFNT returns the parsed font of a typecase. For font collections, this is
+// the selected face. The font data is read and parsed on first call only.
+func (tc *Typecase) SFNT() (*sfnt.Font, error) {
+	p := tc.parsed
+	p.once.Do(func() {
+		data, err := tc.scalableFont.ReadFontData()
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.sfnt, p.err = ParseFace(data, tc.scalableFont.CollectionIndex())
+	})
+	return p.sfnt, p.err
+}
+
+// Face returns a font.Face for a typecase, usable for drawing text with
+// package golang.org/x/image/font. The face is created on first call only,
+// or on the first call after Close.
+func (tc *Typecase) Face() (font.Face, error) {
+	tc.faceMutex.Lock()
+	defer tc.faceMutex.Unlock()
+	if tc.face != nil || tc.faceErr != nil {
+		return tc.face, tc.faceErr
+	}
+	f, err := tc.SFNT()
+	if err != nil {
+		tc.faceErr = err
+		return nil, err
+	}
+	// package opentype calculates ppem from PostScript points (72 per
+	// inch), we use printer's points (72.27 per inch, see PtIn)
+	tc.face, tc.faceErr = opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    float64(tc.size) * 72 / 72.27,
+		DPI:     float64(tc.dpi),
+		Hinting: font.HintingNone,
+	})
+	return tc.face, tc.faceErr
+}
+
+// Close releases the font.Face of a typecase, if it has been created.
+func (tc *Typecase) Close() error {
+	tc.faceMutex.Lock()
+	defer tc.faceMutex.Unlock()
+	if tc.face == nil {
+		return nil
+	}
+	err := tc.face.Close()
+	tc.face = nil
+	return err
+}
+
+// PpEm returns the pixels per em of a typecase (see PpEm).
+func (tc *Typecase) PpEm() fixed.Int26_6 {
+	return PpEm(floatToFixed(tc.size), tc.dpi)
+}
+
+// UnitsPerEm returns the number of font units per em of a typecase's font.
+func (tc *Typecase) UnitsPerEm() (sfnt.Units, error) {
+	f, err := tc.SFNT()
+	if err != nil {
+		return 0, err
+	}
+	return f.UnitsPerEm(), nil
+}
+
+// RasterCoords transforms u, a value in font units, into pixel coordinates
+// for a typecase (see RasterCoords).
+func (tc *Typecase) RasterCoords(u sfnt.Units) (fixed.Int26_6, error) {
+	f, err := tc.SFNT()
+	if err != nil {
+		return 0, err
+	}
+	return RasterCoords(u, f, floatToFixed(tc.size), tc.dpi), nil
+}
+
+func floatToFixed(f float32) fixed.Int26_6 {
+	return fixed.Int26_6(f * 64)
+}
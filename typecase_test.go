@@ -0,0 +1,63 @@
+package fontfind
+
+import (
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
+)
+
+func TestTypecase(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	tc, err := NewTypecase(FallbackFont(), 12, 72.27, language.Script{}, language.BritishEnglish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.Script().String() != "Latn" {
+		t.Errorf("expected script to be derived from language, is %s", tc.Script())
+	}
+	if tc.PpEm() != fixed.I(12) {
+		t.Errorf("expected 12 ppem for 12pt at 72.27 dpi, got %v", tc.PpEm())
+	}
+	face, err := tc.Face()
+	if err != nil {
+		t.Fatal(err)
+	}
+	adv, ok := face.GlyphAdvance('m')
+	if !ok || adv <= 0 {
+		t.Fatalf("expected glyph for 'm' with positive advance, got %v", adv)
+	}
+	upem, _ := tc.UnitsPerEm()
+	if x, _ := tc.RasterCoords(upem); x != tc.PpEm() {
+		t.Errorf("expected 1 em to be %v pixels, got %v", tc.PpEm(), x)
+	}
+	big, err := tc.WithSize(24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f1, _ := tc.SFNT()
+	f2, _ := big.SFNT()
+	if f1 != f2 {
+		t.Errorf("expected typecases of different size to share the parsed font")
+	}
+	bigface, _ := big.Face()
+	if bigAdv, _ := bigface.GlyphAdvance('m'); bigAdv < 2*adv-fixed.I(1) || bigAdv > 2*adv+fixed.I(1) {
+		t.Errorf("expected advance at 24pt to be twice the advance at 12pt, got %v vs %v", bigAdv, adv)
+	}
+	done := make(chan struct{})
+	go func() {
+		big.Face()
+		close(done)
+	}()
+	if err := big.Close(); err != nil {
+		t.Error(err)
+	}
+	<-done
+	tc.Close()
+	if face, err := tc.Face(); err != nil || face == nil {
+		t.Errorf("expected face to be created again after Close, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package fontfind
+
+import (
+	"encoding/binary"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// Variable fonts contain a continuous design space instead of a single
+// design. The design space is spanned by variation axes, e.g. weight or width,
+// and a font may name some points in this space ("named instances"). See
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otvaroverview and
+// https://docs.microsoft.com/en-us/typography/opentype/spec/fvar
+
+// Axis is a variation axis of a variable font.
+type Axis struct {
+	Tag     string  // axis tag, e.g. "wght"
+	Name    string  // axis name from the font's name table, may be empty
+	Min     float32 // minimum coordinate
+	Default float32 // default coordinate
+	Max     float32 // maximum coordinate
+	Hidden  bool    // axis should not be exposed to end users
+}
+
+// Clamp restricts a coordinate to the range of an axis.
+func (a Axis) Clamp(v float32) float32 {
+	return min(max(v, a.Min), a.Max)
+}
+
+// Covers returns true if v lies within the range of an axis.
+func (a Axis) Covers(v float32) bool {
+	return v >= a.Min && v <= a.Max
+}
+
+// NamedInstance is an instance of a variable font pre-defined by the font,
+// e.g. "SemiBold Condensed".
+type NamedInstance struct {
+	Name   string             // subfamily name of the instance
+	Coords map[string]float32 // coordinates of the instance by axis tag
+}
+
+// Variation describes the design space of a variable font together with the
+// axis coordinates selected for an instance.
+type Variation struct {
+	Axes      []Axis             // variation axes of the font
+	Instances []NamedInstance    // named instances defined by the font
+	Coords    map[string]float32 // coordinates to apply, by axis tag
+}
+
+// Axis returns the variation axis with a given tag.
+func (v Variation) Axis(tag string) (Axis, bool) {
+	return findAxis(v.Axes, tag)
+}
+
+// Registered axis tags, see
+// https://docs.microsoft.com/en-us/typography/opentype/spec/dvaraxisreg
+const (
+	AxisWeight      = "wght"
+	AxisWidth       = "wdth"
+	AxisItalic      = "ital"
+	AxisSlant       = "slnt"
+	AxisOpticalSize = "opsz"
+)
+
+// defaultObliqueAngle is the slant used for oblique and synthesized italic
+// instances, following CSS (font-style: oblique defaults to 14deg).
+// Slant axis values are counter-clockwise, hence negative.
+const defaultObliqueAngle = -14
+
+func findAxis(axes []Axis, tag string) (Axis, bool) {
+	for _, a := range axes {
+		if a.Tag == tag {
+			return a, true
+		}
+	}
+	return Axis{}, false
+}
+
+// InstanceCoords computes the axis coordinates of a variable font which
+// realize a font descriptor. Axes not present in the font are ignored and
+// coordinates are clamped to the range of their axis.
+//
+// Explicit values in desc.Variations take precedence. Otherwise weight is
+// taken from desc.WeightValue, width from desc.Stretch, optical size from
+// desc.OpticalSize, and italic or oblique styles are realized by the ital or
+// slnt axis.
+func InstanceCoords(axes []Axis, desc Descriptor) map[string]float32 {
+	if len(axes) == 0 {
+		return nil
+	}
+	coords := make(map[string]float32, len(axes))
+	set := func(tag string, v float32) {
+		if a, ok := findAxis(axes, tag); ok {
+			coords[tag] = a.Clamp(v)
+		}
+	}
+	set(AxisWeight, desc.WeightValue())
+	set(AxisWidth, float32(desc.Stretch.Normalized()))
+	if desc.OpticalSize > 0 {
+		set(AxisOpticalSize, desc.OpticalSize)
+	}
+	switch desc.Style {
+	case font.StyleItalic:
+		if _, ok := findAxis(axes, AxisItalic); ok {
+			set(AxisItalic, 1)
+		} else {
+			set(AxisSlant, defaultObliqueAngle)
+		}
+	case font.StyleOblique:
+		set(AxisSlant, defaultObliqueAngle)
+	}
+	for tag, v := range desc.Variations {
+		set(tag, v)
+	}
+	return coords
+}
+
+// readFvar reads variation axes and named instances from an fvar table.
+// Names are looked up in the name table of face f.
+func readFvar(fvar []byte, f *sfnt.Font, buf *sfnt.Buffer) ([]Axis, []NamedInstance) {
+	if len(fvar) < 16 {
+		return nil, nil
+	}
+	be := binary.BigEndian
+	offset := int(be.Uint16(fvar[4:]))
+	axisCount, axisSize := int(be.Uint16(fvar[8:])), int(be.Uint16(fvar[10:]))
+	instCount, instSize := int(be.Uint16(fvar[12:])), int(be.Uint16(fvar[14:]))
+	if axisSize < 20 || instSize < 4+4*axisCount ||
+		offset+axisCount*axisSize+instCount*instSize > len(fvar) {
+		return nil, nil
+	}
+	axes := make([]Axis, axisCount)
+	for i := range axes {
+		rec := fvar[offset+i*axisSize:]
+		axes[i] = Axis{
+			Tag:     string(rec[:4]),
+			Min:     fixed1616(rec[4:]),
+			Default: fixed1616(rec[8:]),
+			Max:     fixed1616(rec[12:]),
+			Hidden:  be.Uint16(rec[16:])&0x0001 != 0,
+		}
+		axes[i].Name, _ = f.Name(buf, sfnt.NameID(be.Uint16(rec[18:])))
+	}
+	instances := make([]NamedInstance, instCount)
+	offset += axisCount * axisSize
+	for i := range instances {
+		rec := fvar[offset+i*instSize:]
+		instances[i].Name, _ = f.Name(buf, sfnt.NameID(be.Uint16(rec)))
+		instances[i].Coords = make(map[string]float32, axisCount)
+		for j, a := range axes {
+			instances[i].Coords[a.Tag] = fixed1616(rec[4+4*j:])
+		}
+	}
+	return axes, instances
+}
+
+// fixed1616 decodes a 16.16 fixed-point number.
+func fixed1616(b []byte) float32 {
+	return float32(int32(binary.BigEndian.Uint32(b))) / 0x10000
+}
+
+// --- Variable font instances -----------------------------------------------
+
+// IsVariable returns true if this font is a variable font.
+func (f *ScalableFont) IsVariable() bool {
+	return f.variation != nil && len(f.variation.Axes) > 0
+}
+
+// Variation returns the design space of a variable font together with the
+// coordinates selected for the requested instance (see SelectInstance).
+// For static fonts, Variation returns a zero value.
+func (f *ScalableFont) Variation() Variation {
+	if f.variation == nil {
+		return Variation{}
+	}
+	return *f.variation
+}
+
+// Coordinates returns the axis coordinates clients have to apply to a
+// variable font to get the requested instance. For static fonts, Coordinates
+// returns nil.
+func (f *ScalableFont) Coordinates() map[string]float32 {
+	if f.variation == nil {
+		return nil
+	}
+	return f.variation.Coords
+}
+
+// SetVariation sets the design space of a variable font. Locators use this
+// for variable fonts whose axes are known from sources other than the font
+// file, e.g. a font directory service.
+func (f *ScalableFont) SetVariation(v Variation) {
+	f.variation = &v
+}
+
+// SelectInstance selects the instance of a variable font realizing desc and
+// updates style, weight and stretch of the font accordingly. For static
+// fonts SelectInstance does nothing.
+func (f *ScalableFont) SelectInstance(desc Descriptor) {
+	if !f.IsVariable() {
+		return
+	}
+	v := *f.variation // do not modify instances shared with copies of f
+	v.Coords = InstanceCoords(v.Axes, desc)
+	f.variation = &v
+	if w, ok := v.Coords[AxisWeight]; ok {
+		f.Weight = WeightFromClass(int(math.Round(float64(w))))
+	}
+	if wd, ok := v.Coords[AxisWidth]; ok {
+		f.Stretch = Stretch(wd)
+	}
+	if v.Coords[AxisItalic] >= 1 {
+		f.Style = font.StyleItalic
+	} else if v.Coords[AxisSlant] != 0 {
+		f.Style = font.StyleOblique
+	}
+}
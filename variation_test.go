@@ -0,0 +1,117 @@
+package fontfind
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/image/font"
+)
+
+func TestReadVariationAxes(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	faces, err := ReadFaceInfo(makeVariableFont(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := faces[0]
+	if !fi.IsVariable() || len(fi.Axes) != 2 {
+		t.Fatalf("expected variable font with 2 axes, got %v", fi.Axes)
+	}
+	if a := fi.Axes[0]; a.Tag != AxisWeight || a.Min != 100 || a.Default != 400 || a.Max != 900 {
+		t.Errorf("unexpected weight axis %+v", a)
+	}
+	if len(fi.Instances) != 1 || fi.Instances[0].Name != "Regular" {
+		t.Fatalf("expected named instance Regular, got %v", fi.Instances)
+	}
+	if fi.Instances[0].Coords[AxisWidth] != 100 {
+		t.Errorf("expected instance Regular to be of normal width, is %v", fi.Instances[0].Coords)
+	}
+}
+
+func TestSelectInstance(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.font")
+	defer teardown()
+	//
+	data := makeVariableFont(t)
+	desc := Descriptor{
+		Pattern:    "Go",
+		Weight:     font.WeightSemiBold,
+		Stretch:    StretchSemiCondensed,
+		Variations: map[string]float32{AxisWeight: 650},
+	}
+	fi, confidence := MatchFontFile(data, "GoVF.otf", desc)
+	if confidence != PerfectConfidence {
+		t.Fatalf("expected variable font to match weight 650, confidence is %d", confidence)
+	}
+	sf := ScalableFont{Name: "GoVF.otf"}
+	sf.SetFS(fstest.MapFS{"GoVF.otf": &fstest.MapFile{Data: data}}, "GoVF.otf")
+	sf.SetMetadata(fi)
+	sf.SelectInstance(desc)
+	coords := sf.Coordinates()
+	if coords[AxisWeight] != 650 || coords[AxisWidth] != 87.5 {
+		t.Errorf("expected coordinates wght=650 wdth=87.5, got %v", coords)
+	}
+	if sf.Weight != font.WeightBold || sf.Stretch != StretchSemiCondensed {
+		t.Errorf("expected bold semi-condensed instance, got weight=%d stretch=%v", sf.Weight, sf.Stretch)
+	}
+	desc.Variations[AxisWeight] = 950
+	desc.Stretch = StretchUltraCondensed
+	if coords := InstanceCoords(fi.Axes, desc); coords[AxisWeight] != 900 || coords[AxisWidth] != 75 {
+		t.Errorf("expected coordinates to be clamped, got %v", coords)
+	}
+}
+
+// makeVariableFont adds an fvar table with a weight axis (100…900) and a
+// width axis (75…100) to a packaged static font.
+func makeVariableFont(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("locate/fallbackfont/packaged/Go-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	be := binary.BigEndian
+	fvar := make([]byte, 16+2*20+(4+2*4))
+	for i, v := range []uint16{1, 0, 16, 2, 2, 20, 1, 4 + 2*4} {
+		be.PutUint16(fvar[2*i:], v)
+	}
+	axis := func(rec []byte, tag string, min, def, max int32) {
+		copy(rec, tag)
+		be.PutUint32(rec[4:], uint32(min<<16))
+		be.PutUint32(rec[8:], uint32(def<<16))
+		be.PutUint32(rec[12:], uint32(max<<16))
+		be.PutUint16(rec[18:], 2)
+	}
+	axis(fvar[16:], AxisWeight, 100, 400, 900)
+	axis(fvar[36:], AxisWidth, 75, 100, 100)
+	inst := fvar[56:]
+	be.PutUint16(inst, 2) // subfamily name ID → "Regular"
+	be.PutUint32(inst[4:], 400<<16)
+	be.PutUint32(inst[8:], 100<<16)
+	// insert fvar into the (sorted) table directory, moving tables back by 16 bytes
+	numTables := int(be.Uint16(data[4:]))
+	dirEnd := 12 + 16*numTables
+	out := append([]byte{}, data[:12]...)
+	be.PutUint16(out[4:], uint16(numTables+1))
+	fvarRec := make([]byte, 16)
+	copy(fvarRec, "fvar")
+	be.PutUint32(fvarRec[8:], uint32(len(data)+16))
+	be.PutUint32(fvarRec[12:], uint32(len(fvar)))
+	for i := 0; i < numTables; i++ {
+		rec := append([]byte{}, data[12+16*i:12+16*(i+1)]...)
+		be.PutUint32(rec[8:], be.Uint32(rec[8:])+16)
+		if fvarRec != nil && string(rec[:4]) > "fvar" {
+			out, fvarRec = append(out, fvarRec...), nil
+		}
+		out = append(out, rec...)
+	}
+	if fvarRec != nil {
+		out = append(out, fvarRec...)
+	}
+	out = append(out, data[dirEnd:]...)
+	return append(out, fvar...)
+}